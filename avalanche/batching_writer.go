@@ -0,0 +1,290 @@
+package avalanche
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/mark-rushakoff/mountainflux/river"
+)
+
+// BatchingWriterConfig is the configuration used to create a BatchingWriter.
+type BatchingWriterConfig struct {
+	// Maximum number of lines in a batch; a batch is written once it has this many lines.
+	// Defaults to 100.
+	MaxLines int
+
+	// If positive, a batch is also written once it has at least this many bytes.
+	MaxBytes int
+
+	// If positive, a batch is also written once this long has passed since its first line was added,
+	// so that lines don't wait indefinitely for a batch to fill up.
+	Linger time.Duration
+
+	// Number of batches that may wait for a free writer before adding lines blocks.
+	// Defaults to the number of writers.
+	QueueSize int
+
+	// Precision of the timestamps written by WritePoint.
+	// Defaults to nanoseconds.
+	Precision river.Precision
+
+	// If set, batches are written open-loop: each batch is written at its send time on Schedule,
+	// and its latency is measured from that time rather than from the start of the write,
+	// so that time spent waiting for a free writer counts against the writers.
+	// Time spent waiting for a batch to fill up stalls the Schedule.
+	Schedule *Schedule
+
+	// If set, OnWrite is called with the result of every batch written.
+	// It may be called concurrently from each writer's goroutine.
+	OnWrite func(r BatchResult)
+}
+
+// BatchResult describes the write of a single batch by a BatchingWriter.
+type BatchResult struct {
+	// Number of lines and bytes in the batch.
+	Lines int
+	Bytes int
+
+	// Latency of the write in nanoseconds.
+	// With a Schedule, it is measured from the batch's send time on the Schedule.
+	LatencyNs int64
+
+	// With a Schedule, how long in nanoseconds the batch waited past its send time for a free writer.
+	DelayNs int64
+
+	Err error
+}
+
+// BatchingWriter accumulates individual lines into batches,
+// and writes each batch to the next free writer from a pool of underlying LineProtocolWriters.
+// Each writer is used by one goroutine at a time.
+//
+// A BatchingWriter is safe for concurrent use.
+// Close or CloseContext must be called to write the final batch and stop the writers' goroutines.
+type BatchingWriter struct {
+	c BatchingWriterConfig
+
+	// Context of every write, canceled by CloseContext to abandon the remaining batches.
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu sync.Mutex
+	b  *lineBatch
+
+	// Incremented each time a batch is queued, so that a linger timer can tell
+	// whether the batch it was started for is still the current one.
+	gen   int
+	timer *time.Timer
+
+	closed bool
+
+	// Scratch space for WritePoint, guarded by mu.
+	scratch []byte
+
+	queue chan *lineBatch
+	pool  sync.Pool
+	wg    sync.WaitGroup
+}
+
+type lineBatch struct {
+	buf   []byte
+	lines int
+}
+
+var errBatchingWriterClosed = errors.New("write to closed BatchingWriter")
+
+// NewBatchingWriter returns a new BatchingWriter that writes batches to writers according to c,
+// and starts a goroutine for each writer.
+// Each writer is adapted by WithContext, so that CloseContext can cancel its writes.
+// It returns an error if no writers are given.
+func NewBatchingWriter(c BatchingWriterConfig, writers ...LineProtocolWriter) (*BatchingWriter, error) {
+	if len(writers) == 0 {
+		return nil, errors.New("BatchingWriter requires at least one writer")
+	}
+	if c.MaxLines <= 0 {
+		c.MaxLines = 100
+	}
+	if c.QueueSize <= 0 {
+		c.QueueSize = len(writers)
+	}
+
+	w := &BatchingWriter{
+		c:     c,
+		queue: make(chan *lineBatch, c.QueueSize),
+	}
+	w.pool.New = func() interface{} {
+		return &lineBatch{}
+	}
+	w.b = w.pool.Get().(*lineBatch)
+	w.ctx, w.cancel = context.WithCancel(context.Background())
+
+	w.wg.Add(len(writers))
+	for _, lw := range writers {
+		go w.writeBatches(WithContext(lw))
+	}
+
+	return w, nil
+}
+
+// WriteLine adds a single line of line protocol to the current batch,
+// appending a newline if line doesn't end with one.
+// line is copied, so it may be reused as soon as WriteLine returns.
+//
+// If the batch is then full, it is queued for writing,
+// blocking while the queue is full.
+func (w *BatchingWriter) WriteLine(line []byte) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.addLocked(line)
+}
+
+// WritePoint adds p to the current batch, as written by river.AppendPointPrecision
+// with the configured Precision.
+// Otherwise it behaves like WriteLine.
+func (w *BatchingWriter) WritePoint(p *river.Point) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.scratch = river.AppendPointPrecision(w.scratch[:0], p, w.c.Precision)
+	return w.addLocked(w.scratch)
+}
+
+func (w *BatchingWriter) addLocked(line []byte) error {
+	if w.closed {
+		return errBatchingWriterClosed
+	}
+
+	b := w.b
+	b.buf = append(b.buf, line...)
+	if len(line) == 0 || line[len(line)-1] != '\n' {
+		b.buf = append(b.buf, '\n')
+	}
+	b.lines++
+
+	if b.lines >= w.c.MaxLines || (w.c.MaxBytes > 0 && len(b.buf) >= w.c.MaxBytes) {
+		w.queueLocked()
+	} else if b.lines == 1 && w.c.Linger > 0 {
+		gen := w.gen
+		w.timer = time.AfterFunc(w.c.Linger, func() {
+			w.mu.Lock()
+			defer w.mu.Unlock()
+
+			if w.gen == gen && !w.closed {
+				w.queueLocked()
+			}
+		})
+	}
+
+	return nil
+}
+
+// Flush queues the current batch for writing, if it has any lines, without waiting for it to be written.
+func (w *BatchingWriter) Flush() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.closed {
+		return errBatchingWriterClosed
+	}
+	w.queueLocked()
+	return nil
+}
+
+// queueLocked queues the current batch, if it has any lines, and starts a new one.
+func (w *BatchingWriter) queueLocked() {
+	if w.b.lines == 0 {
+		return
+	}
+
+	if w.timer != nil {
+		w.timer.Stop()
+		w.timer = nil
+	}
+	w.gen++
+
+	w.queue <- w.b
+	w.b = w.pool.Get().(*lineBatch)
+}
+
+// Close queues the current batch, waits for every queued batch to be written, and stops the writers' goroutines.
+// Lines added after Close return an error.
+func (w *BatchingWriter) Close() error {
+	w.mu.Lock()
+	if w.closed {
+		w.mu.Unlock()
+		return nil
+	}
+	w.queueLocked()
+	w.closed = true
+	close(w.queue)
+	w.mu.Unlock()
+
+	w.wg.Wait()
+	w.cancel()
+	return nil
+}
+
+// CloseContext is like Close, but once ctx is done, it cancels in-flight writes and waits on the Schedule,
+// and abandons the remaining batches, which are reported to OnWrite with ctx's error.
+// It returns ctx.Err() if any batches may not have been written.
+func (w *BatchingWriter) CloseContext(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		w.Close()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		w.cancel()
+		<-done
+		return ctx.Err()
+	}
+}
+
+// writeBatches writes each batch from the queue to lw until the queue is closed.
+func (w *BatchingWriter) writeBatches(lw ContextLineProtocolWriter) {
+	defer w.wg.Done()
+
+	sched := w.c.Schedule
+	for {
+		var b *lineBatch
+		var ok bool
+		select {
+		case b, ok = <-w.queue:
+		default:
+			// The queue is empty, so waiting for the next batch to fill up
+			// is why this batch is late, not the writers.
+			b, ok = <-w.queue
+			if ok && sched != nil {
+				sched.Stall()
+			}
+		}
+		if !ok {
+			return
+		}
+
+		r := BatchResult{Lines: b.lines, Bytes: len(b.buf)}
+		if sched == nil {
+			r.LatencyNs, r.Err = lw.WriteLineProtocolContext(w.ctx, b.buf)
+		} else if t, err := sched.Next(w.ctx); err != nil {
+			r.Err = err
+		} else {
+			r.DelayNs = time.Since(t).Nanoseconds()
+			_, r.Err = lw.WriteLineProtocolContext(w.ctx, b.buf)
+			r.LatencyNs = time.Since(t).Nanoseconds()
+		}
+		if w.c.OnWrite != nil {
+			w.c.OnWrite(r)
+		}
+
+		b.buf = b.buf[:0]
+		b.lines = 0
+		w.pool.Put(b)
+	}
+}
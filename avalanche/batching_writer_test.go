@@ -0,0 +1,270 @@
+package avalanche_test
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mark-rushakoff/mountainflux/avalanche"
+	"github.com/mark-rushakoff/mountainflux/river"
+)
+
+func newBatchingWriter(t *testing.T, c avalanche.BatchingWriterConfig, writers ...avalanche.LineProtocolWriter) *avalanche.BatchingWriter {
+	w, err := avalanche.NewBatchingWriter(c, writers...)
+	if err != nil {
+		t.Fatalf("expected no error, got: %s", err.Error())
+	}
+	return w
+}
+
+func TestBatchingWriter_MaxLines(t *testing.T) {
+	rw := &recordingWriter{}
+	var mu sync.Mutex
+	var written []int
+	w := newBatchingWriter(t, avalanche.BatchingWriterConfig{
+		MaxLines: 3,
+		OnWrite: func(r avalanche.BatchResult) {
+			mu.Lock()
+			written = append(written, r.Lines)
+			mu.Unlock()
+		},
+	}, rw)
+
+	for i := 0; i < 10; i++ {
+		// Lines without a trailing newline get one.
+		if err := w.WriteLine([]byte(fmt.Sprintf("cpu usage=%d", i))); err != nil {
+			t.Fatalf("expected no error, got: %s", err.Error())
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("expected no error, got: %s", err.Error())
+	}
+
+	exp := []string{
+		"cpu usage=0\ncpu usage=1\ncpu usage=2\n",
+		"cpu usage=3\ncpu usage=4\ncpu usage=5\n",
+		"cpu usage=6\ncpu usage=7\ncpu usage=8\n",
+		"cpu usage=9\n",
+	}
+	if !reflect.DeepEqual(rw.bodies, exp) {
+		t.Fatalf("got: %q\nexp: %q", rw.bodies, exp)
+	}
+	if !reflect.DeepEqual(written, []int{3, 3, 3, 1}) {
+		t.Fatalf("expected OnWrite for each batch, got: %v", written)
+	}
+
+	if err := w.WriteLine([]byte("cpu usage=10")); err == nil {
+		t.Fatalf("expected error writing after Close, got nil")
+	}
+}
+
+func TestBatchingWriter_MaxBytes(t *testing.T) {
+	rw := &recordingWriter{}
+	w := newBatchingWriter(t, avalanche.BatchingWriterConfig{MaxBytes: 20}, rw)
+
+	// 12 bytes per line, so each batch fills up after 2 lines.
+	for i := 0; i < 5; i++ {
+		w.WriteLine([]byte(fmt.Sprintf("cpu usage=%d\n", i)))
+	}
+	w.Close()
+
+	exp := []string{
+		"cpu usage=0\ncpu usage=1\n",
+		"cpu usage=2\ncpu usage=3\n",
+		"cpu usage=4\n",
+	}
+	if !reflect.DeepEqual(rw.bodies, exp) {
+		t.Fatalf("got: %q\nexp: %q", rw.bodies, exp)
+	}
+}
+
+func TestBatchingWriter_Linger(t *testing.T) {
+	rw := &recordingWriter{}
+	w := newBatchingWriter(t, avalanche.BatchingWriterConfig{Linger: 20 * time.Millisecond}, rw)
+	defer w.Close()
+
+	w.WriteLine([]byte("cpu usage=1"))
+	w.WriteLine([]byte("cpu usage=2"))
+
+	deadline := time.Now().Add(time.Second)
+	for rw.writes() == 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected batch to be written after linger duration")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if got := rw.lines(); !reflect.DeepEqual(got, []string{"cpu usage=1", "cpu usage=2"}) {
+		t.Fatalf("got: %q", got)
+	}
+
+	// A flushed batch doesn't leave a timer behind to flush the next batch early.
+	w.WriteLine([]byte("cpu usage=3"))
+	w.Flush()
+	w.WriteLine([]byte("cpu usage=4"))
+	for rw.writes() < 2 {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected flushed batch to be written")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	time.Sleep(10 * time.Millisecond)
+	if n := rw.writes(); n != 2 {
+		t.Fatalf("expected 2 writes, got: %d", n)
+	}
+}
+
+func TestBatchingWriter_WritePoint(t *testing.T) {
+	rw := &recordingWriter{}
+	w := newBatchingWriter(t, avalanche.BatchingWriterConfig{Precision: river.Second}, rw)
+
+	p := river.Point{
+		Measurement: []byte("cpu"),
+		Tags:        []river.Tag{{Key: []byte("host"), Value: []byte("h1")}},
+		Fields:      []river.Field{river.Float{Name: []byte("usage"), Value: 99}},
+		Time:        1435362189575692182,
+		HasTime:     true,
+	}
+	if err := w.WritePoint(&p); err != nil {
+		t.Fatalf("expected no error, got: %s", err.Error())
+	}
+	w.Close()
+
+	if exp := []string{"cpu,host=h1 usage=99 1435362189\n"}; !reflect.DeepEqual(rw.bodies, exp) {
+		t.Fatalf("got: %q\nexp: %q", rw.bodies, exp)
+	}
+}
+
+func TestBatchingWriter_Pool(t *testing.T) {
+	ws := []*recordingWriter{{}, {}, {}}
+	w := newBatchingWriter(t, avalanche.BatchingWriterConfig{MaxLines: 10}, ws[0], ws[1], ws[2])
+
+	// Write concurrently from several goroutines.
+	var wg sync.WaitGroup
+	var exp []string
+	for g := 0; g < 4; g++ {
+		for i := 0; i < 250; i++ {
+			exp = append(exp, fmt.Sprintf("cpu,g=%d usage=%d", g, i))
+		}
+
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 250; i++ {
+				w.WriteLine([]byte(fmt.Sprintf("cpu,g=%d usage=%d", g, i)))
+			}
+		}(g)
+	}
+	wg.Wait()
+	w.Close()
+
+	// Every line is written exactly once, across all the writers.
+	var got []string
+	for _, rw := range ws {
+		got = append(got, rw.lines()...)
+	}
+	sort.Strings(got)
+	sort.Strings(exp)
+	if !reflect.DeepEqual(got, exp) {
+		t.Fatalf("expected each of %d lines to be written once, got %d lines", len(exp), len(got))
+	}
+}
+
+func TestBatchingWriter_NoWriters(t *testing.T) {
+	if _, err := avalanche.NewBatchingWriter(avalanche.BatchingWriterConfig{}); err == nil {
+		t.Fatalf("expected error without writers, got nil")
+	}
+}
+
+func TestBatchingWriter_Schedule(t *testing.T) {
+	const (
+		interval = 5 * time.Millisecond
+		writeLat = 20 * time.Millisecond
+		n        = 5
+	)
+
+	var mu sync.Mutex
+	var results []avalanche.BatchResult
+	w := newBatchingWriter(t, avalanche.BatchingWriterConfig{
+		MaxLines:  1,
+		QueueSize: n,
+		Schedule:  avalanche.NewSchedule(interval),
+		OnWrite: func(r avalanche.BatchResult) {
+			mu.Lock()
+			results = append(results, r)
+			mu.Unlock()
+		},
+	}, latencyWriter{latency: writeLat})
+
+	for i := 0; i < n; i++ {
+		w.WriteLine([]byte(fmt.Sprintf("cpu usage=%d", i)))
+	}
+	w.Close()
+
+	if len(results) != n {
+		t.Fatalf("expected %d results, got: %d", n, len(results))
+	}
+
+	// A single writer, four times slower than the schedule, falls further behind with each batch,
+	// and each batch's latency includes the time it waited for the batches before it.
+	for i, r := range results {
+		if r.Err != nil {
+			t.Fatalf("expected no error, got: %s", r.Err.Error())
+		}
+		if exp := time.Duration(i)*(writeLat-interval) - interval; time.Duration(r.DelayNs) < exp {
+			t.Fatalf("expected batch %d to wait at least %v past its send time, got: %v", i, exp, time.Duration(r.DelayNs))
+		}
+		if exp := time.Duration(i+1)*writeLat - time.Duration(i)*interval - interval; time.Duration(r.LatencyNs) < exp {
+			t.Fatalf("expected latency of batch %d to be at least %v, got: %v", i, exp, time.Duration(r.LatencyNs))
+		}
+	}
+}
+
+// cancelableWriter signals on started when a write begins, then blocks until ctx is done.
+type cancelableWriter struct {
+	started chan<- struct{}
+}
+
+func (w cancelableWriter) WriteLineProtocol(body []byte) (int64, error) {
+	return w.WriteLineProtocolContext(context.Background(), body)
+}
+
+func (w cancelableWriter) WriteLineProtocolContext(ctx context.Context, body []byte) (int64, error) {
+	w.started <- struct{}{}
+	<-ctx.Done()
+	return 0, ctx.Err()
+}
+
+func TestBatchingWriter_CloseContext(t *testing.T) {
+	started := make(chan struct{}, 2)
+
+	var mu sync.Mutex
+	var errs []error
+	w := newBatchingWriter(t, avalanche.BatchingWriterConfig{
+		MaxLines: 1,
+		OnWrite: func(r avalanche.BatchResult) {
+			mu.Lock()
+			errs = append(errs, r.Err)
+			mu.Unlock()
+		},
+	}, cancelableWriter{started: started})
+
+	// The first batch blocks in the writer, and the second waits in the queue.
+	w.WriteLine([]byte("cpu usage=1"))
+	w.WriteLine([]byte("cpu usage=2"))
+	<-started
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := w.CloseContext(ctx); err != context.Canceled {
+		t.Fatalf("expected %v, got: %v", context.Canceled, err)
+	}
+
+	// Both the in-flight and the queued batch are reported as canceled.
+	if exp := []error{context.Canceled, context.Canceled}; !reflect.DeepEqual(errs, exp) {
+		t.Fatalf("got: %v, exp: %v", errs, exp)
+	}
+}
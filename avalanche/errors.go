@@ -0,0 +1,257 @@
+package avalanche
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/valyala/fasthttp"
+)
+
+// WriteError is returned by HTTPWriter when the server responds to a write with an unexpected status.
+type WriteError struct {
+	// HTTP status code of the response.
+	StatusCode int
+
+	// Error code from the response body, as sent by InfluxDB 2.x, e.g. "invalid".
+	// Empty for InfluxDB 1.x, which does not send error codes.
+	Code string
+
+	// Error message from the response body.
+	// If the body isn't a JSON InfluxDB error, Message is the whole body.
+	Message string
+
+	// Number of points the server reported dropping in a partial write, parsed from "dropped=N" in Message.
+	// Zero if the server did not report a count.
+	DroppedPoints int
+
+	// How long the server asked the client to wait before retrying, from the Retry-After header.
+	// Zero if the header was absent.
+	RetryAfter time.Duration
+}
+
+func (e *WriteError) Error() string {
+	if e.Code != "" {
+		return fmt.Sprintf("Invalid write response (status %d): %s: %s", e.StatusCode, e.Code, e.Message)
+	}
+	return fmt.Sprintf("Invalid write response (status %d): %s", e.StatusCode, e.Message)
+}
+
+// Partial reports whether the server wrote some of the points and rejected the rest,
+// as InfluxDB reports with a message containing "partial write".
+func (e *WriteError) Partial() bool {
+	return strings.Contains(e.Message, "partial write")
+}
+
+// ErrorCategory is a coarse classification of a failed write, suitable for use as a tag value.
+type ErrorCategory string
+
+const (
+	// Some points were written and the rest were rejected, e.g. due to a field type conflict.
+	CategoryPartialWrite ErrorCategory = "partial_write"
+
+	// The request was malformed or its points could not be parsed.
+	CategoryBadRequest ErrorCategory = "bad_request"
+
+	// The credentials were missing or rejected.
+	CategoryUnauthorized ErrorCategory = "unauthorized"
+
+	// The database, retention policy, or bucket does not exist.
+	CategoryNotFound ErrorCategory = "not_found"
+
+	// The request body exceeded the server's size limit.
+	CategoryTooLarge ErrorCategory = "too_large"
+
+	// The server asked the client to slow down.
+	CategoryThrottled ErrorCategory = "throttled"
+
+	// The server failed to handle the write, or is unavailable.
+	CategoryServerError ErrorCategory = "server_error"
+
+	// The request timed out, e.g. due to HTTPWriterConfig.Timeout or the deadline of a context passed to WriteLineProtocolContext.
+	CategoryTimeout ErrorCategory = "timeout"
+
+	// The request was canceled by the client, e.g. through a context passed to WriteLineProtocolContext.
+	CategoryCanceled ErrorCategory = "canceled"
+
+	// The writer was created with an invalid configuration, so the request was never sent.
+	CategoryConfigError ErrorCategory = "config_error"
+
+	// The request never got a response, e.g. because the connection was refused.
+	CategoryTransportError ErrorCategory = "transport_error"
+)
+
+// Category classifies e by its status code and message.
+func (e *WriteError) Category() ErrorCategory {
+	switch {
+	case e.Partial():
+		return CategoryPartialWrite
+	case e.StatusCode == http.StatusUnauthorized || e.StatusCode == http.StatusForbidden:
+		return CategoryUnauthorized
+	case e.StatusCode == http.StatusNotFound:
+		return CategoryNotFound
+	case e.StatusCode == http.StatusRequestEntityTooLarge:
+		return CategoryTooLarge
+	case e.StatusCode == http.StatusTooManyRequests:
+		return CategoryThrottled
+	case e.StatusCode >= 500:
+		return CategoryServerError
+	}
+	return CategoryBadRequest
+}
+
+// Categorize classifies err, as returned from a LineProtocolWriter.
+// Errors are matched as with errors.As and errors.Is, so wrapped errors are classified by what they wrap:
+// *WriteErrors by their Category, *ConfigErrors as CategoryConfigError,
+// timeouts and expired deadlines as CategoryTimeout, and canceled contexts as CategoryCanceled.
+// Any other error is assumed to come from the transport.
+// It returns the empty string if err is nil.
+func Categorize(err error) ErrorCategory {
+	if err == nil {
+		return ""
+	}
+
+	var we *WriteError
+	if errors.As(err, &we) {
+		return we.Category()
+	}
+	var ce *ConfigError
+	if errors.As(err, &ce) {
+		return CategoryConfigError
+	}
+
+	switch {
+	case errors.Is(err, context.DeadlineExceeded) || errors.Is(err, fasthttp.ErrTimeout):
+		return CategoryTimeout
+	case errors.Is(err, context.Canceled):
+		return CategoryCanceled
+	}
+	return CategoryTransportError
+}
+
+// Temporary reports whether the write may succeed if retried:
+// true for 429 Too Many Requests and 5xx responses, false otherwise.
+// In particular, a 400 partial write will never succeed on retry.
+func (e *WriteError) Temporary() bool {
+	return e.StatusCode == http.StatusTooManyRequests || e.StatusCode >= 500
+}
+
+// ConfigError is returned from every write of a writer created with an invalid configuration,
+// such as an invalid GzipLevel or TLS files that can't be loaded.
+// Retrying will never succeed.
+type ConfigError struct {
+	Err error
+}
+
+func (e *ConfigError) Error() string {
+	return "invalid writer configuration: " + e.Err.Error()
+}
+
+func (e *ConfigError) Unwrap() error {
+	return e.Err
+}
+
+// Temporary always returns false.
+func (e *ConfigError) Temporary() bool {
+	return false
+}
+
+// transportError wraps an error from sending a request that never got a response,
+// such as a refused connection or a timeout, which may succeed if retried.
+type transportError struct {
+	err error
+}
+
+func (e *transportError) Error() string {
+	return e.err.Error()
+}
+
+func (e *transportError) Unwrap() error {
+	return e.err
+}
+
+func (e *transportError) Temporary() bool {
+	return true
+}
+
+// newWriteError returns a *WriteError for an unsuccessful write response
+// with the given status code, body, and Retry-After header value.
+func newWriteError(statusCode int, body, retryAfter []byte) *WriteError {
+	e := &WriteError{
+		StatusCode: statusCode,
+		RetryAfter: parseRetryAfter(retryAfter, time.Now()),
+	}
+	e.Code, e.Message = errorMessage(body)
+	e.DroppedPoints = droppedPoints(e.Message)
+	return e
+}
+
+// errorMessage extracts the error code and message from the body of an unsuccessful write response.
+// InfluxDB 1.x responds with JSON of form {"error": "..."},
+// and 2.x with JSON of form {"code": "...", "message": "..."}.
+// If body is neither, the code is empty and the message is body as-is.
+func errorMessage(body []byte) (code, message string) {
+	var e struct {
+		Error   string `json:"error"`
+		Code    string `json:"code"`
+		Message string `json:"message"`
+	}
+	if err := json.Unmarshal(body, &e); err != nil {
+		return "", string(body)
+	}
+
+	switch {
+	case e.Message != "":
+		return e.Code, e.Message
+	case e.Error != "":
+		return "", e.Error
+	}
+
+	return "", string(body)
+}
+
+var droppedRegexp = regexp.MustCompile(`dropped=(\d+)`)
+
+// droppedPoints returns the number of dropped points reported in msg,
+// e.g. 2 for "partial write: points beyond retention policy dropped=2",
+// or 0 if msg doesn't report a count.
+func droppedPoints(msg string) int {
+	m := droppedRegexp.FindStringSubmatch(msg)
+	if m == nil {
+		return 0
+	}
+
+	n, err := strconv.Atoi(m[1])
+	if err != nil {
+		return 0
+	}
+	return n
+}
+
+// parseRetryAfter parses the value of a Retry-After header,
+// which is either a number of seconds or an HTTP date, relative to now.
+// It returns zero if v is empty or invalid.
+func parseRetryAfter(v []byte, now time.Time) time.Duration {
+	if len(v) == 0 {
+		return 0
+	}
+
+	if secs, err := strconv.Atoi(string(v)); err == nil {
+		if secs < 0 {
+			return 0
+		}
+		return time.Duration(secs) * time.Second
+	}
+
+	if t, err := http.ParseTime(string(v)); err == nil && t.After(now) {
+		return t.Sub(now)
+	}
+
+	return 0
+}
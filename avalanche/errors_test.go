@@ -0,0 +1,159 @@
+package avalanche_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/mark-rushakoff/mountainflux/avalanche"
+	"github.com/valyala/fasthttp"
+)
+
+var writeErrorTests = []struct {
+	name       string
+	statusCode int
+	body       string
+
+	exp         avalanche.WriteError
+	expCategory avalanche.ErrorCategory
+}{
+	{
+		name:       "1.x partial write",
+		statusCode: http.StatusBadRequest,
+		body:       `{"error":"partial write: field type conflict: input field \"usage\" on measurement \"cpu\" is type integer, already exists as type float dropped=3"}`,
+		exp: avalanche.WriteError{
+			StatusCode:    http.StatusBadRequest,
+			Message:       `partial write: field type conflict: input field "usage" on measurement "cpu" is type integer, already exists as type float dropped=3`,
+			DroppedPoints: 3,
+		},
+		expCategory: avalanche.CategoryPartialWrite,
+	},
+	{
+		name:       "2.x partial write",
+		statusCode: http.StatusUnprocessableEntity,
+		body:       `{"code":"unprocessable entity","message":"failure writing points to database: partial write: points beyond retention policy dropped=12"}`,
+		exp: avalanche.WriteError{
+			StatusCode:    http.StatusUnprocessableEntity,
+			Code:          "unprocessable entity",
+			Message:       "failure writing points to database: partial write: points beyond retention policy dropped=12",
+			DroppedPoints: 12,
+		},
+		expCategory: avalanche.CategoryPartialWrite,
+	},
+	{
+		name:       "unparseable line",
+		statusCode: http.StatusBadRequest,
+		body:       `{"error":"unable to parse 'cpu usage=': missing field value"}`,
+		exp: avalanche.WriteError{
+			StatusCode: http.StatusBadRequest,
+			Message:    "unable to parse 'cpu usage=': missing field value",
+		},
+		expCategory: avalanche.CategoryBadRequest,
+	},
+	{
+		name:       "database not found",
+		statusCode: http.StatusNotFound,
+		body:       `{"error":"database not found: \"mydb\""}`,
+		exp: avalanche.WriteError{
+			StatusCode: http.StatusNotFound,
+			Message:    `database not found: "mydb"`,
+		},
+		expCategory: avalanche.CategoryNotFound,
+	},
+	{
+		name:       "unauthorized",
+		statusCode: http.StatusUnauthorized,
+		body:       `{"code":"unauthorized","message":"unauthorized access"}`,
+		exp: avalanche.WriteError{
+			StatusCode: http.StatusUnauthorized,
+			Code:       "unauthorized",
+			Message:    "unauthorized access",
+		},
+		expCategory: avalanche.CategoryUnauthorized,
+	},
+	{
+		name:       "too large",
+		statusCode: http.StatusRequestEntityTooLarge,
+		body:       `{"error":"Request Entity Too Large"}`,
+		exp: avalanche.WriteError{
+			StatusCode: http.StatusRequestEntityTooLarge,
+			Message:    "Request Entity Too Large",
+		},
+		expCategory: avalanche.CategoryTooLarge,
+	},
+	{
+		name:       "throttled",
+		statusCode: http.StatusTooManyRequests,
+		body:       "slow down",
+		exp: avalanche.WriteError{
+			StatusCode: http.StatusTooManyRequests,
+			Message:    "slow down",
+		},
+		expCategory: avalanche.CategoryThrottled,
+	},
+	{
+		name:       "unavailable",
+		statusCode: http.StatusServiceUnavailable,
+		body:       "",
+		exp: avalanche.WriteError{
+			StatusCode: http.StatusServiceUnavailable,
+		},
+		expCategory: avalanche.CategoryServerError,
+	},
+}
+
+func TestHTTPWriter_WriteError(t *testing.T) {
+	for _, wt := range writeErrorTests {
+		h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(wt.statusCode)
+			w.Write([]byte(wt.body))
+		})
+		s := httptest.NewServer(h)
+
+		w := avalanche.NewHTTPWriter(avalanche.HTTPWriterConfig{
+			Host:     s.URL,
+			Database: "mydb",
+		})
+		_, err := w.WriteLineProtocol([]byte("cpu usage=99"))
+		s.Close()
+
+		we, ok := err.(*avalanche.WriteError)
+		if !ok {
+			t.Errorf("%s: expected *WriteError, got: %v", wt.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(*we, wt.exp) {
+			t.Errorf("%s:\ngot: %+v\nexp: %+v", wt.name, *we, wt.exp)
+		}
+		if c := avalanche.Categorize(err); c != wt.expCategory {
+			t.Errorf("%s: expected category %q, got: %q", wt.name, wt.expCategory, c)
+		}
+	}
+}
+
+func TestCategorize(t *testing.T) {
+	for _, ct := range []struct {
+		err error
+		exp avalanche.ErrorCategory
+	}{
+		{nil, ""},
+		{context.Canceled, avalanche.CategoryCanceled},
+		{fmt.Errorf("write aborted: %w", context.Canceled), avalanche.CategoryCanceled},
+		{context.DeadlineExceeded, avalanche.CategoryTimeout},
+		{fmt.Errorf("write aborted: %w", context.DeadlineExceeded), avalanche.CategoryTimeout},
+		{fasthttp.ErrTimeout, avalanche.CategoryTimeout},
+		{errors.New("connection refused"), avalanche.CategoryTransportError},
+		{&avalanche.WriteError{StatusCode: http.StatusBadRequest}, avalanche.CategoryBadRequest},
+		{fmt.Errorf("endpoint a: %w", &avalanche.WriteError{StatusCode: http.StatusServiceUnavailable}), avalanche.CategoryServerError},
+		{&avalanche.ConfigError{Err: errors.New("bad gzip level")}, avalanche.CategoryConfigError},
+		{fmt.Errorf("endpoint a: %w", &avalanche.ConfigError{Err: errors.New("bad gzip level")}), avalanche.CategoryConfigError},
+	} {
+		if got := avalanche.Categorize(ct.err); got != ct.exp {
+			t.Errorf("%v: expected %q, got: %q", ct.err, ct.exp, got)
+		}
+	}
+}
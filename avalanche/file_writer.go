@@ -0,0 +1,211 @@
+package avalanche
+
+import (
+	"compress/gzip"
+	"errors"
+	"io"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Stdout is the FileWriterConfig.Path that writes to standard output instead of a file.
+const Stdout = "-"
+
+// FileWriterConfig is the configuration used to create a FileWriter.
+type FileWriterConfig struct {
+	// Path of the file to write to, which is truncated if it exists,
+	// or Stdout to write to standard output.
+	Path string
+
+	// If set, the output is gzip-compressed.
+	// Each rotated file is a complete gzip stream.
+	Gzip bool
+
+	// Compression level to use when Gzip is set, from gzip.BestSpeed to gzip.BestCompression.
+	// Defaults to gzip.DefaultCompression.
+	GzipLevel int
+
+	// If positive, once at least MaxBytes of line protocol, before compression, have been written to Path,
+	// Path is rotated: it is renamed to Path.1, Path.2, and so on, replacing any existing file of that name,
+	// and a new, empty Path is started.
+	// Files are only rotated between writes, so no write is split across files.
+	// Ignored when writing to Stdout.
+	MaxBytes int64
+}
+
+// FileWriter is a LineProtocolWriter that writes to a file or standard output,
+// e.g. to record exactly what a benchmark sent, for later replay or debugging.
+// A FileWriter is safe for concurrent use; each write is written whole.
+// Close must be called to flush any compressed output.
+type FileWriter struct {
+	c FileWriterConfig
+
+	mu sync.Mutex
+
+	// The current file, or nil when writing to stdout.
+	f *os.File
+
+	// Destination of writes: f, stdout, or zw wrapping either.
+	out io.Writer
+	zw  *gzip.Writer
+
+	// Bytes written to the current file, before compression.
+	n int64
+
+	// Number of files rotated so far.
+	rotations int
+
+	// Set while a rotation is in progress; a rotation that fails partway is resumed by the next write.
+	rotating bool
+
+	// Set once the current file has been renamed during a rotation, so that it isn't renamed again.
+	renamed bool
+
+	closed bool
+}
+
+var _ LineProtocolWriter = (*FileWriter)(nil)
+
+var errFileWriterClosed = errors.New("write to closed FileWriter")
+
+// NewFileWriter returns a new FileWriter from the supplied FileWriterConfig.
+// It returns an error if the file can't be created or GzipLevel is invalid.
+func NewFileWriter(c FileWriterConfig) (*FileWriter, error) {
+	w := &FileWriter{c: c}
+
+	if c.Gzip {
+		level := c.GzipLevel
+		if level == 0 {
+			level = gzip.DefaultCompression
+		}
+
+		var err error
+		w.zw, err = gzip.NewWriterLevel(nil, level)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if c.Path == Stdout {
+		w.setOutput(os.Stdout)
+		return w, nil
+	}
+
+	if err := w.open(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// open creates the file at w.c.Path and directs output to it.
+func (w *FileWriter) open() error {
+	f, err := os.Create(w.c.Path)
+	if err != nil {
+		return err
+	}
+
+	w.f = f
+	w.n = 0
+	w.setOutput(f)
+	return nil
+}
+
+func (w *FileWriter) setOutput(dst io.Writer) {
+	if w.zw != nil {
+		w.zw.Reset(dst)
+		w.out = w.zw
+	} else {
+		w.out = dst
+	}
+}
+
+// WriteLineProtocol writes body to the file, rotating the file first if it has reached the configured MaxBytes.
+// It returns the latency in nanoseconds of writing, including any compression and rotation, and any error from doing so.
+func (w *FileWriter) WriteLineProtocol(body []byte) (int64, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	start := time.Now()
+	if w.closed {
+		return 0, errFileWriterClosed
+	}
+
+	if w.rotating || (w.f != nil && w.c.MaxBytes > 0 && w.n >= w.c.MaxBytes) {
+		if err := w.rotate(); err != nil {
+			return time.Since(start).Nanoseconds(), err
+		}
+	}
+
+	n, err := w.out.Write(body)
+	w.n += int64(n)
+	return time.Since(start).Nanoseconds(), err
+}
+
+// rotate closes the current file, renames it to the next rotated name, and opens a new file.
+// If any step fails, its error is returned and the next call resumes from that step,
+// so that a transient failure, such as a full disk, doesn't stop the FileWriter for good.
+func (w *FileWriter) rotate() error {
+	w.rotating = true
+
+	if w.f != nil {
+		// The file is closed even if closing fails, so this step is never repeated.
+		if err := w.closeFile(); err != nil {
+			return err
+		}
+	}
+
+	if !w.renamed {
+		if err := os.Rename(w.c.Path, w.c.Path+"."+strconv.Itoa(w.rotations+1)); err != nil {
+			return err
+		}
+		w.rotations++
+		w.renamed = true
+	}
+
+	if err := w.open(); err != nil {
+		return err
+	}
+
+	w.rotating = false
+	w.renamed = false
+	return nil
+}
+
+// closeFile flushes any compressed output and closes the current file, if any.
+func (w *FileWriter) closeFile() error {
+	var err error
+	if w.zw != nil {
+		err = w.zw.Close()
+	}
+
+	if w.f != nil {
+		if cerr := w.f.Close(); err == nil {
+			err = cerr
+		}
+		w.f = nil
+	}
+
+	w.out = nil
+	return err
+}
+
+// Close flushes any compressed output and closes the file.
+// Standard output is flushed but not closed.
+// Writes after Close return an error.
+func (w *FileWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+
+	if w.out == nil {
+		// A failed rotation already closed the file.
+		return nil
+	}
+	return w.closeFile()
+}
@@ -0,0 +1,167 @@
+package avalanche_test
+
+import (
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mark-rushakoff/mountainflux/avalanche"
+)
+
+func TestFileWriter_Write(t *testing.T) {
+	dir, err := ioutil.TempDir("", "avalanche-file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "out.lp")
+	w, err := avalanche.NewFileWriter(avalanche.FileWriterConfig{Path: path})
+	if err != nil {
+		t.Fatalf("expected no error, got: %s", err.Error())
+	}
+
+	for _, body := range []string{"cpu usage=1\n", "cpu usage=2\n"} {
+		if _, err := w.WriteLineProtocol([]byte(body)); err != nil {
+			t.Fatalf("expected no error, got: %s", err.Error())
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("expected no error, got: %s", err.Error())
+	}
+
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exp := "cpu usage=1\ncpu usage=2\n"; string(b) != exp {
+		t.Fatalf("got: %q, exp: %q", b, exp)
+	}
+
+	if _, err := w.WriteLineProtocol([]byte("cpu usage=3\n")); err == nil {
+		t.Fatalf("expected error writing after Close, got nil")
+	}
+}
+
+func TestFileWriter_GzipRotation(t *testing.T) {
+	dir, err := ioutil.TempDir("", "avalanche-file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "out.lp.gz")
+	w, err := avalanche.NewFileWriter(avalanche.FileWriterConfig{
+		Path:     path,
+		Gzip:     true,
+		MaxBytes: 20,
+	})
+	if err != nil {
+		t.Fatalf("expected no error, got: %s", err.Error())
+	}
+
+	// 12 bytes per write, so the file rotates after every second write.
+	for _, body := range []string{"cpu usage=1\n", "cpu usage=2\n", "cpu usage=3\n", "cpu usage=4\n", "cpu usage=5\n"} {
+		if _, err := w.WriteLineProtocol([]byte(body)); err != nil {
+			t.Fatalf("expected no error, got: %s", err.Error())
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("expected no error, got: %s", err.Error())
+	}
+
+	for _, ft := range []struct {
+		path string
+		exp  string
+	}{
+		{path + ".1", "cpu usage=1\ncpu usage=2\n"},
+		{path + ".2", "cpu usage=3\ncpu usage=4\n"},
+		{path, "cpu usage=5\n"},
+	} {
+		f, err := os.Open(ft.path)
+		if err != nil {
+			t.Fatalf("expected no error, got: %s", err.Error())
+		}
+		zr, err := gzip.NewReader(f)
+		if err != nil {
+			t.Fatalf("%s: expected gzip stream, got: %s", ft.path, err.Error())
+		}
+		b, err := ioutil.ReadAll(zr)
+		f.Close()
+		if err != nil {
+			t.Fatalf("%s: expected no error, got: %s", ft.path, err.Error())
+		}
+		if string(b) != ft.exp {
+			t.Errorf("%s: got: %q, exp: %q", ft.path, b, ft.exp)
+		}
+	}
+}
+
+func TestFileWriter_InvalidConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "avalanche-file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	if _, err := avalanche.NewFileWriter(avalanche.FileWriterConfig{Path: filepath.Join(dir, "out.lp.gz"), Gzip: true, GzipLevel: 42}); err == nil {
+		t.Errorf("expected error for invalid gzip level, got nil")
+	}
+	if _, err := avalanche.NewFileWriter(avalanche.FileWriterConfig{Path: filepath.Join(dir, "missing", "out.lp")}); err == nil {
+		t.Errorf("expected error for missing directory, got nil")
+	}
+}
+
+func TestFileWriter_FailedRotation(t *testing.T) {
+	dir, err := ioutil.TempDir("", "avalanche-file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "out.lp")
+	w, err := avalanche.NewFileWriter(avalanche.FileWriterConfig{Path: path, MaxBytes: 1})
+	if err != nil {
+		t.Fatalf("expected no error, got: %s", err.Error())
+	}
+	if _, err := w.WriteLineProtocol([]byte("cpu f=1\n")); err != nil {
+		t.Fatalf("expected no error, got: %s", err.Error())
+	}
+
+	// A non-empty directory in the way of the rotated file makes the rename fail, even with write permission.
+	if err := os.MkdirAll(filepath.Join(path+".1", "blocker"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	_, err = w.WriteLineProtocol([]byte("cpu f=2\n"))
+	if _, ok := err.(*os.LinkError); !ok {
+		t.Fatalf("expected rename error, got: %v", err)
+	}
+
+	// Once the rename can succeed, the next write resumes the rotation.
+	if err := os.RemoveAll(path + ".1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.WriteLineProtocol([]byte("cpu f=3\n")); err != nil {
+		t.Fatalf("expected rotation to resume, got: %s", err.Error())
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("expected no error, got: %s", err.Error())
+	}
+
+	for _, ft := range []struct {
+		path, exp string
+	}{
+		{path + ".1", "cpu f=1\n"},
+		{path, "cpu f=3\n"},
+	} {
+		b, err := ioutil.ReadFile(ft.path)
+		if err != nil {
+			t.Fatalf("expected no error, got: %s", err.Error())
+		}
+		if string(b) != ft.exp {
+			t.Errorf("%s: got: %q, exp: %q", ft.path, b, ft.exp)
+		}
+	}
+}
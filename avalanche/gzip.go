@@ -0,0 +1,54 @@
+package avalanche
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"sync"
+)
+
+// gzipPool reuses gzip writers and their output buffers across writes,
+// so that compression doesn't dominate allocations.
+type gzipPool struct {
+	pool sync.Pool
+}
+
+type gzipBuffer struct {
+	buf bytes.Buffer
+	zw  *gzip.Writer
+}
+
+// newGzipPool returns a gzipPool compressing at the given level,
+// or an error if the level is invalid.
+func newGzipPool(level int) (*gzipPool, error) {
+	if _, err := gzip.NewWriterLevel(ioutil.Discard, level); err != nil {
+		return nil, err
+	}
+
+	p := &gzipPool{}
+	p.pool.New = func() interface{} {
+		// Level was already validated, so it's safe to ignore the error.
+		zw, _ := gzip.NewWriterLevel(ioutil.Discard, level)
+		return &gzipBuffer{zw: zw}
+	}
+	return p, nil
+}
+
+// compress compresses body into a pooled buffer and calls fn with the compressed bytes.
+// The compressed bytes are only valid until fn returns.
+func (p *gzipPool) compress(body []byte, fn func(compressed []byte)) error {
+	gb := p.pool.Get().(*gzipBuffer)
+	defer p.pool.Put(gb)
+
+	gb.buf.Reset()
+	gb.zw.Reset(&gb.buf)
+	if _, err := gb.zw.Write(body); err != nil {
+		return err
+	}
+	if err := gb.zw.Close(); err != nil {
+		return err
+	}
+
+	fn(gb.buf.Bytes())
+	return nil
+}
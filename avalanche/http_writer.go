@@ -2,10 +2,17 @@
 package avalanche
 
 import (
+	"compress/gzip"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
 	"fmt"
+	"io/ioutil"
 	"net/url"
 	"time"
 
+	"github.com/mark-rushakoff/mountainflux/river"
 	"github.com/valyala/fasthttp"
 )
 
@@ -15,7 +22,60 @@ type HTTPWriterConfig struct {
 	Host string
 
 	// Name of the target database into which points will be written.
+	// Ignored when Bucket is set.
 	Database string
+
+	// Name of the retention policy into which points will be written.
+	// Defaults to the database's default retention policy. Ignored when Bucket is set.
+	RetentionPolicy string
+
+	// Write consistency level for clustered InfluxDB: "any", "one", "quorum", or "all".
+	// Defaults to the server's default. Ignored when Bucket is set.
+	Consistency string
+
+	// Organization and bucket into which points will be written on an InfluxDB 2.x server.
+	// If Bucket is set, writes go to the 2.x /api/v2/write endpoint instead of the 1.x /write endpoint.
+	// 2.x servers also require a Token.
+	Org    string
+	Bucket string
+
+	// Credentials for servers with authentication enabled, sent with HTTP basic auth.
+	Username string
+	Password string
+
+	// Token for servers that use token authentication, such as InfluxDB 2.x,
+	// sent as `Authorization: Token <Token>`.
+	// If Token is set, Username and Password are ignored.
+	Token string
+
+	// Precision of the timestamps in the written line protocol,
+	// e.g. as written by river.WriteLinePrecision.
+	// Defaults to nanoseconds, in which case no precision parameter is sent.
+	Precision river.Precision
+
+	// Maximum time to wait for a single write request to complete, including reading the response.
+	// Defaults to no timeout.
+	Timeout time.Duration
+
+	// If set, request bodies are gzip-compressed and sent with `Content-Encoding: gzip`.
+	Gzip bool
+
+	// Compression level to use when Gzip is set, from gzip.BestSpeed to gzip.BestCompression.
+	// Defaults to gzip.DefaultCompression.
+	GzipLevel int
+
+	// Path to a PEM file of CA certificates used to verify an https Host's certificate,
+	// e.g. for a server with a self-signed certificate.
+	// Defaults to the system's CA certificates.
+	TLSCAFile string
+
+	// Paths to a PEM client certificate and its key, presented to https Hosts that require mutual TLS.
+	TLSCertFile string
+	TLSKeyFile  string
+
+	// If set, an https Host's certificate chain and host name are not verified.
+	// Only use this for testing.
+	InsecureSkipVerify bool
 }
 
 // HTTPWriter is a Writer that writes to an InfluxDB HTTP server.
@@ -24,48 +84,252 @@ type HTTPWriter struct {
 
 	c   HTTPWriterConfig
 	url []byte
+
+	// Value of the Authorization header, or nil if no credentials are configured.
+	auth []byte
+
+	// Only set if c.Gzip is set.
+	gzip *gzipPool
+
+	// Error in c, such as an invalid GzipLevel or an unreadable TLSCAFile, returned from every write.
+	configErr error
 }
 
+var _ ContextLineProtocolWriter = (*HTTPWriter)(nil)
+
 // NewHTTPWriter returns a new HTTPWriter from the supplied HTTPWriterConfig.
+// If c specifies an invalid GzipLevel or TLS files that can't be loaded,
+// every call to WriteLineProtocol returns a *ConfigError describing it.
 func NewHTTPWriter(c HTTPWriterConfig) LineProtocolWriter {
-	return &HTTPWriter{
+	w := &HTTPWriter{
 		client: fasthttp.Client{
 			Name: "avalanche",
 		},
 
-		c:   c,
-		url: []byte(c.Host + "/write?db=" + url.QueryEscape(c.Database)),
+		c:    c,
+		url:  []byte(writeURL(c)),
+		auth: authorization(c),
+	}
+
+	var err error
+	w.client.TLSConfig, err = tlsConfig(c)
+
+	if c.Gzip && err == nil {
+		level := c.GzipLevel
+		if level == 0 {
+			level = gzip.DefaultCompression
+		}
+		w.gzip, err = newGzipPool(level)
+	}
+
+	if err != nil {
+		w.configErr = &ConfigError{Err: err}
+	}
+
+	return w
+}
+
+// tlsConfig returns the TLS configuration described by c,
+// or nil if c has no TLS options set, in which case the client's defaults apply.
+func tlsConfig(c HTTPWriterConfig) (*tls.Config, error) {
+	if c.TLSCAFile == "" && c.TLSCertFile == "" && c.TLSKeyFile == "" && !c.InsecureSkipVerify {
+		return nil, nil
+	}
+
+	cfg := &tls.Config{
+		InsecureSkipVerify: c.InsecureSkipVerify,
+	}
+
+	if c.TLSCAFile != "" {
+		pem, err := ioutil.ReadFile(c.TLSCAFile)
+		if err != nil {
+			return nil, err
+		}
+		cfg.RootCAs = x509.NewCertPool()
+		if !cfg.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in TLS CA file %s", c.TLSCAFile)
+		}
+	}
+
+	if c.TLSCertFile != "" || c.TLSKeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(c.TLSCertFile, c.TLSKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+
+	return cfg, nil
+}
+
+// authorization returns the Authorization header value for the credentials in c,
+// or nil if c has no credentials.
+func authorization(c HTTPWriterConfig) []byte {
+	if c.Token != "" {
+		return []byte("Token " + c.Token)
 	}
+
+	if c.Username != "" || c.Password != "" {
+		return []byte("Basic " + base64.StdEncoding.EncodeToString([]byte(c.Username+":"+c.Password)))
+	}
+
+	return nil
+}
+
+// writeURL returns the full URL of the write endpoint described by c.
+func writeURL(c HTTPWriterConfig) string {
+	if c.Bucket != "" {
+		return c.Host + "/api/v2/write?" + v2WriteParams(c).Encode()
+	}
+	return c.Host + "/write?" + v1WriteParams(c).Encode()
+}
+
+// v1WriteParams returns the query parameters for the 1.x /write endpoint described by c.
+func v1WriteParams(c HTTPWriterConfig) url.Values {
+	v := url.Values{"db": []string{c.Database}}
+	if c.RetentionPolicy != "" {
+		v.Set("rp", c.RetentionPolicy)
+	}
+	if c.Consistency != "" {
+		v.Set("consistency", c.Consistency)
+	}
+	if c.Precision != river.Nanosecond {
+		v.Set("precision", v1Precision(c.Precision))
+	}
+	return v
+}
+
+// v2WriteParams returns the query parameters for the 2.x /api/v2/write endpoint described by c.
+func v2WriteParams(c HTTPWriterConfig) url.Values {
+	v := url.Values{
+		"org":    []string{c.Org},
+		"bucket": []string{c.Bucket},
+	}
+	if c.Precision != river.Nanosecond {
+		v.Set("precision", c.Precision.String())
+	}
+	return v
+}
+
+// v1Precision returns the value of the precision parameter that InfluxDB 1.x expects for p.
+// 1.x uses "u" rather than "us" for microseconds.
+func v1Precision(p river.Precision) string {
+	if p == river.Microsecond {
+		return "u"
+	}
+	return p.String()
 }
 
 var (
-	post      = []byte("POST")
-	textPlain = []byte("text/plain")
+	post                = []byte("POST")
+	textPlain           = []byte("text/plain")
+	contentEncoding     = []byte("Content-Encoding")
+	gzipEncoding        = []byte("gzip")
+	authorizationHeader = []byte("Authorization")
 )
 
 // WriteLineProtocol writes the given byte slice to the HTTP server described in the Writer's HTTPWriterConfig.
 // It returns the latency in nanoseconds and any error received while sending the data over HTTP,
 // or it returns a new error if the HTTP response isn't as expected.
+// When gzip is enabled, the time spent compressing the body is not included in the latency.
 func (w *HTTPWriter) WriteLineProtocol(body []byte) (int64, error) {
+	return w.WriteLineProtocolContext(context.Background(), body)
+}
+
+// WriteLineProtocolContext is like WriteLineProtocol, but gives up on the request
+// when ctx is done or its deadline passes, returning ctx.Err().
+// If both ctx and the HTTPWriterConfig specify a deadline, the earlier one applies.
+func (w *HTTPWriter) WriteLineProtocolContext(ctx context.Context, body []byte) (int64, error) {
+	if w.configErr != nil {
+		return 0, w.configErr
+	}
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
 	req := fasthttp.AcquireRequest()
 	req.Header.SetContentTypeBytes(textPlain)
 	req.Header.SetMethodBytes(post)
 	req.Header.SetRequestURIBytes(w.url)
-	req.SetBody(body)
+	if w.auth != nil {
+		req.Header.SetBytesKV(authorizationHeader, w.auth)
+	}
+	if w.gzip != nil {
+		req.Header.SetBytesKV(contentEncoding, gzipEncoding)
+
+		// SetBody copies the compressed bytes, so the pooled buffer can be reused immediately.
+		if err := w.gzip.compress(body, req.SetBody); err != nil {
+			fasthttp.ReleaseRequest(req)
+			return 0, err
+		}
+	} else {
+		req.SetBody(body)
+	}
 
 	resp := fasthttp.AcquireResponse()
 	start := time.Now()
-	err := w.client.Do(req, resp)
-	lat := time.Since(start).Nanoseconds()
-	if err == nil {
-		sc := resp.StatusCode()
-		if sc != fasthttp.StatusNoContent {
-			err = fmt.Errorf("Invalid write response (status %d): %s", sc, resp.Body())
+	deadline, hasDeadline := w.deadline(ctx, start)
+
+	if ctx.Done() == nil {
+		// ctx can never be canceled, so there's no need for the extra goroutine below.
+		err := w.do(req, resp, deadline, hasDeadline)
+		lat := time.Since(start).Nanoseconds()
+		fasthttp.ReleaseResponse(resp)
+		fasthttp.ReleaseRequest(req)
+		return lat, err
+	}
+
+	// fasthttp can't cancel an in-flight request, so make the request in the background
+	// and stop waiting for it if ctx is canceled.
+	done := make(chan error, 1)
+	go func() {
+		done <- w.do(req, resp, deadline, hasDeadline)
+	}()
+
+	select {
+	case err := <-done:
+		lat := time.Since(start).Nanoseconds()
+		fasthttp.ReleaseResponse(resp)
+		fasthttp.ReleaseRequest(req)
+		return lat, err
+	case <-ctx.Done():
+		lat := time.Since(start).Nanoseconds()
+		go func() {
+			// Only release the request and response once the client is finished with them.
+			<-done
+			fasthttp.ReleaseResponse(resp)
+			fasthttp.ReleaseRequest(req)
+		}()
+		return lat, ctx.Err()
+	}
+}
+
+// deadline returns the earlier of ctx's deadline and the configured timeout after start, if either is set.
+func (w *HTTPWriter) deadline(ctx context.Context, start time.Time) (time.Time, bool) {
+	deadline, ok := ctx.Deadline()
+	if w.c.Timeout > 0 {
+		if t := start.Add(w.c.Timeout); !ok || t.Before(deadline) {
+			return t, true
 		}
 	}
+	return deadline, ok
+}
 
-	fasthttp.ReleaseResponse(resp)
-	fasthttp.ReleaseRequest(req)
+// do executes req, filling in resp, and returns a transport error or a *WriteError for an unexpected response.
+func (w *HTTPWriter) do(req *fasthttp.Request, resp *fasthttp.Response, deadline time.Time, hasDeadline bool) error {
+	var err error
+	if hasDeadline {
+		err = w.client.DoDeadline(req, resp, deadline)
+	} else {
+		err = w.client.Do(req, resp)
+	}
+	if err != nil {
+		return &transportError{err: err}
+	}
+
+	if sc := resp.StatusCode(); sc != fasthttp.StatusNoContent {
+		return newWriteError(sc, resp.Body(), resp.Header.Peek("Retry-After"))
+	}
 
-	return lat, err
+	return nil
 }
@@ -1,13 +1,20 @@
 package avalanche_test
 
 import (
+	"bytes"
+	"compress/gzip"
+	"context"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/mark-rushakoff/mountainflux/avalanche"
+	"github.com/mark-rushakoff/mountainflux/river"
 )
 
 func TestHTTPWriter_Write(t *testing.T) {
@@ -48,3 +55,315 @@ func TestHTTPWriter_Write(t *testing.T) {
 		t.Fatalf("got: %v, exp: %v", lastReq, line)
 	}
 }
+
+var precisionTests = []struct {
+	precision river.Precision
+	exp       string
+}{
+	{river.Nanosecond, ""},
+	{river.Microsecond, "u"},
+	{river.Millisecond, "ms"},
+	{river.Second, "s"},
+}
+
+func TestHTTPWriter_Precision(t *testing.T) {
+	var lastPrecision string
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lastPrecision = r.URL.Query().Get("precision")
+		w.WriteHeader(http.StatusNoContent)
+	})
+	s := httptest.NewServer(h)
+	defer s.Close()
+
+	for _, pt := range precisionTests {
+		w := avalanche.NewHTTPWriter(avalanche.HTTPWriterConfig{
+			Host:      s.URL,
+			Database:  "mydb",
+			Precision: pt.precision,
+		})
+
+		if _, err := w.WriteLineProtocol([]byte("cpu usage=99 1458507416")); err != nil {
+			t.Fatalf("expected no error, got: %s", err.Error())
+		}
+
+		if lastPrecision != pt.exp {
+			t.Errorf("precision %s: got: %q, exp: %q", pt.precision, lastPrecision, pt.exp)
+		}
+	}
+}
+
+func TestHTTPWriter_Gzip(t *testing.T) {
+	line := []byte("cpu,host=h1 usage=99\n")
+
+	var lastReq string
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Content-Encoding") != "gzip" {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte("expected gzip body"))
+			return
+		}
+
+		zr, err := gzip.NewReader(r.Body)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(err.Error()))
+			return
+		}
+		b, _ := ioutil.ReadAll(zr)
+		lastReq = string(b)
+		w.WriteHeader(http.StatusNoContent)
+	})
+	s := httptest.NewServer(h)
+	defer s.Close()
+
+	w := avalanche.NewHTTPWriter(avalanche.HTTPWriterConfig{
+		Host:      s.URL,
+		Database:  "mydb",
+		Gzip:      true,
+		GzipLevel: gzip.BestSpeed,
+	})
+
+	// Write several times, so that pooled compressors are reused.
+	for i := 1; i <= 3; i++ {
+		body := bytes.Repeat(line, i)
+		if _, err := w.WriteLineProtocol(body); err != nil {
+			t.Fatalf("expected no error, got: %s", err.Error())
+		}
+
+		if lastReq != string(body) {
+			t.Fatalf("got: %v, exp: %v", lastReq, string(body))
+		}
+	}
+}
+
+func TestHTTPWriter_GzipInvalidLevel(t *testing.T) {
+	w := avalanche.NewHTTPWriter(avalanche.HTTPWriterConfig{
+		Host:      "http://127.0.0.1:0",
+		Database:  "mydb",
+		Gzip:      true,
+		GzipLevel: 100,
+	})
+
+	if _, err := w.WriteLineProtocol([]byte("cpu usage=99")); err == nil {
+		t.Fatalf("expected error for invalid gzip level, got nil")
+	}
+}
+
+var authTests = []struct {
+	username, password, token string
+	expAuth                   string
+}{
+	{"", "", "", ""},
+	{"alice", "s3cret", "", "Basic YWxpY2U6czNjcmV0"},
+	{"", "", "mytoken", "Token mytoken"},
+	{"alice", "s3cret", "mytoken", "Token mytoken"},
+}
+
+func TestHTTPWriter_Auth(t *testing.T) {
+	var lastAuth string
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lastAuth = r.Header.Get("Authorization")
+		w.WriteHeader(http.StatusNoContent)
+	})
+	s := httptest.NewServer(h)
+	defer s.Close()
+
+	for _, at := range authTests {
+		w := avalanche.NewHTTPWriter(avalanche.HTTPWriterConfig{
+			Host:     s.URL,
+			Database: "mydb",
+			Username: at.username,
+			Password: at.password,
+			Token:    at.token,
+		})
+
+		// Write twice, to ensure credentials are sent on every request.
+		for i := 0; i < 2; i++ {
+			lastAuth = "unset"
+			if _, err := w.WriteLineProtocol([]byte("cpu usage=99")); err != nil {
+				t.Fatalf("expected no error, got: %s", err.Error())
+			}
+
+			if lastAuth != at.expAuth {
+				t.Errorf("got Authorization: %q, exp: %q", lastAuth, at.expAuth)
+			}
+		}
+	}
+}
+
+func TestHTTPWriter_V2(t *testing.T) {
+	line := []byte("cpu,host=h1 usage=99 1458507416")
+
+	var lastReq string
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if r.URL.Path == "/api/v2/write" && r.Method == "POST" &&
+			q.Get("org") == "myorg" && q.Get("bucket") == "mybucket" && q.Get("precision") == "us" &&
+			r.Header.Get("Authorization") == "Token mytoken" {
+			b, _ := ioutil.ReadAll(r.Body)
+			lastReq = string(b)
+			w.WriteHeader(http.StatusNoContent)
+		} else {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"code":"not found","message":"unexpected request"}`))
+		}
+	})
+	s := httptest.NewServer(h)
+	defer s.Close()
+
+	w := avalanche.NewHTTPWriter(avalanche.HTTPWriterConfig{
+		Host:      s.URL,
+		Org:       "myorg",
+		Bucket:    "mybucket",
+		Token:     "mytoken",
+		Precision: river.Microsecond,
+	})
+	if _, err := w.WriteLineProtocol(line); err != nil {
+		t.Fatalf("expected no error, got: %s", err.Error())
+	}
+	if lastReq != string(line) {
+		t.Fatalf("got: %v, exp: %v", lastReq, string(line))
+	}
+
+	// Wrong bucket gets the server's JSON error message.
+	w = avalanche.NewHTTPWriter(avalanche.HTTPWriterConfig{
+		Host:   s.URL,
+		Org:    "myorg",
+		Bucket: "otherbucket",
+		Token:  "mytoken",
+	})
+	_, err := w.WriteLineProtocol(line)
+	if err == nil {
+		t.Fatalf("expected error, got nil")
+	}
+	if !strings.HasSuffix(err.Error(), "not found: unexpected request") {
+		t.Fatalf("expected error to contain parsed message, got: %s", err.Error())
+	}
+}
+
+func TestHTTPWriter_V1ErrorMessage(t *testing.T) {
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`{"error":"database not found: \"mydb\""}`))
+	})
+	s := httptest.NewServer(h)
+	defer s.Close()
+
+	w := avalanche.NewHTTPWriter(avalanche.HTTPWriterConfig{
+		Host:     s.URL,
+		Database: "mydb",
+	})
+	_, err := w.WriteLineProtocol([]byte("cpu usage=99"))
+	if err == nil {
+		t.Fatalf("expected error, got nil")
+	}
+	if !strings.HasSuffix(err.Error(), `database not found: "mydb"`) {
+		t.Fatalf("expected error to contain parsed message, got: %s", err.Error())
+	}
+}
+
+func TestHTTPWriter_RetentionPolicyAndConsistency(t *testing.T) {
+	var lastQuery url.Values
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lastQuery = r.URL.Query()
+		w.WriteHeader(http.StatusNoContent)
+	})
+	s := httptest.NewServer(h)
+	defer s.Close()
+
+	w := avalanche.NewHTTPWriter(avalanche.HTTPWriterConfig{
+		Host:            s.URL,
+		Database:        "my db",
+		RetentionPolicy: "one week&more=1",
+		Consistency:     "quorum",
+	})
+	if _, err := w.WriteLineProtocol([]byte("cpu usage=99")); err != nil {
+		t.Fatalf("expected no error, got: %s", err.Error())
+	}
+
+	exp := url.Values{
+		"db":          []string{"my db"},
+		"rp":          []string{"one week&more=1"},
+		"consistency": []string{"quorum"},
+	}
+	if !reflect.DeepEqual(lastQuery, exp) {
+		t.Fatalf("got query: %v, exp: %v", lastQuery, exp)
+	}
+
+	// Neither parameter is sent when unset.
+	w = avalanche.NewHTTPWriter(avalanche.HTTPWriterConfig{
+		Host:     s.URL,
+		Database: "mydb",
+	})
+	if _, err := w.WriteLineProtocol([]byte("cpu usage=99")); err != nil {
+		t.Fatalf("expected no error, got: %s", err.Error())
+	}
+	if exp := (url.Values{"db": []string{"mydb"}}); !reflect.DeepEqual(lastQuery, exp) {
+		t.Fatalf("got query: %v, exp: %v", lastQuery, exp)
+	}
+}
+
+func TestHTTPWriter_Timeout(t *testing.T) {
+	release := make(chan struct{})
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		w.WriteHeader(http.StatusNoContent)
+	})
+	s := httptest.NewServer(h)
+	defer s.Close()
+	defer close(release)
+
+	w := avalanche.NewHTTPWriter(avalanche.HTTPWriterConfig{
+		Host:     s.URL,
+		Database: "mydb",
+		Timeout:  20 * time.Millisecond,
+	})
+
+	start := time.Now()
+	_, err := w.WriteLineProtocol([]byte("cpu usage=99"))
+	if err == nil {
+		t.Fatalf("expected timeout error, got nil")
+	}
+	if c := avalanche.Categorize(err); c != avalanche.CategoryTimeout {
+		t.Fatalf("expected timeout to be categorized as %q, got: %q", avalanche.CategoryTimeout, c)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("expected write to time out quickly, took %v", elapsed)
+	}
+}
+
+func TestHTTPWriter_Context(t *testing.T) {
+	release := make(chan struct{})
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		w.WriteHeader(http.StatusNoContent)
+	})
+	s := httptest.NewServer(h)
+	defer s.Close()
+	defer close(release)
+
+	w := avalanche.WithContext(avalanche.NewHTTPWriter(avalanche.HTTPWriterConfig{
+		Host:     s.URL,
+		Database: "mydb",
+	}))
+
+	// Canceled mid-request.
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(20*time.Millisecond, cancel)
+	if _, err := w.WriteLineProtocolContext(ctx, []byte("cpu usage=99")); err != context.Canceled {
+		t.Fatalf("expected context.Canceled, got: %v", err)
+	}
+
+	// Deadline passes mid-request.
+	ctx, cancel = context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if _, err := w.WriteLineProtocolContext(ctx, []byte("cpu usage=99")); err == nil {
+		t.Fatalf("expected error, got nil")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("expected write to give up quickly, took %v", elapsed)
+	}
+}
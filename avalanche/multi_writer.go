@@ -0,0 +1,445 @@
+package avalanche
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/mark-rushakoff/mountainflux/canyon"
+)
+
+// Distribution is how a MultiWriter distributes writes among its endpoints.
+type Distribution int
+
+const (
+	// RoundRobin sends each write to the next endpoint in turn.
+	RoundRobin Distribution = iota
+
+	// LeastOutstanding sends each write to the endpoint with the fewest writes in flight.
+	LeastOutstanding
+
+	// ConsistentHash splits each write by series key,
+	// so that each series is always written to the same endpoint while that endpoint is healthy.
+	ConsistentHash
+)
+
+// ParseDistribution returns the Distribution named by s: "roundrobin", "leastoutstanding", or "hash".
+func ParseDistribution(s string) (Distribution, error) {
+	switch s {
+	case "roundrobin":
+		return RoundRobin, nil
+	case "leastoutstanding":
+		return LeastOutstanding, nil
+	case "hash":
+		return ConsistentHash, nil
+	}
+
+	return 0, fmt.Errorf("unknown distribution %q (expected roundrobin, leastoutstanding, or hash)", s)
+}
+
+func (d Distribution) String() string {
+	switch d {
+	case RoundRobin:
+		return "roundrobin"
+	case LeastOutstanding:
+		return "leastoutstanding"
+	case ConsistentHash:
+		return "hash"
+	}
+
+	return fmt.Sprintf("Distribution(%d)", int(d))
+}
+
+// MultiWriterConfig is the configuration used to create a MultiWriter.
+type MultiWriterConfig struct {
+	// How writes are distributed among endpoints. Defaults to RoundRobin.
+	Distribution Distribution
+
+	// Number of consecutive failed writes after which an endpoint is ejected.
+	// Only errors that suggest the endpoint is unhealthy count as failures:
+	// those that are Retryable, such as transport errors and 5xx responses, other than context errors.
+	// Defaults to 1.
+	MaxFailures int
+
+	// How long an ejected endpoint is skipped before it is tried again.
+	// Defaults to 10s.
+	EjectFor time.Duration
+}
+
+// Endpoint is a single destination of a MultiWriter.
+type Endpoint struct {
+	// Name identifying the endpoint in EndpointStats, e.g. its host.
+	// With ConsistentHash, the name also determines which series the endpoint receives,
+	// so endpoints should have distinct names.
+	Name string
+
+	Writer LineProtocolWriter
+}
+
+// EndpointStats are the statistics of a single endpoint of a MultiWriter since it was created.
+type EndpointStats struct {
+	Name string
+
+	// Number of writes sent to the endpoint, and how many of those failed.
+	// With ConsistentHash, each write is split into one write per endpoint.
+	Writes int64
+	Errors int64
+
+	// Total latency of all writes sent to the endpoint, in nanoseconds.
+	LatencyNs int64
+
+	// Number of writes currently in flight.
+	Outstanding int64
+
+	// Number of times the endpoint has been ejected, and whether it currently is.
+	Ejections int64
+	Ejected   bool
+}
+
+// MultiWriter is a LineProtocolWriter that distributes writes among several endpoints,
+// temporarily ejecting endpoints that fail.
+//
+// With RoundRobin and LeastOutstanding, a write that fails on one endpoint in a way that suggests
+// the endpoint is unhealthy is retried on the next endpoint, until every endpoint has been tried.
+// With ConsistentHash, a failed write is not retried elsewhere;
+// once its endpoint is ejected, that endpoint's series move to the next endpoint on the hash ring.
+// If every endpoint is ejected, writes are distributed among them regardless.
+//
+// A MultiWriter is safe for concurrent use, and should be shared among workers
+// so that its distribution and ejections take every write into account.
+type MultiWriter struct {
+	c MultiWriterConfig
+
+	// Guards the mutable state of each endpoint, and next.
+	mu        sync.Mutex
+	endpoints []*endpoint
+
+	// Index of the endpoint to consider first, always less than len(endpoints).
+	next int
+
+	// Sorted hash ring, only set for ConsistentHash.
+	ring []ringEntry
+
+	// Pool of *hashScratch, only used for ConsistentHash.
+	scratch sync.Pool
+}
+
+var (
+	_ LineProtocolWriter        = (*MultiWriter)(nil)
+	_ ContextLineProtocolWriter = (*MultiWriter)(nil)
+)
+
+type endpoint struct {
+	index int
+	w     ContextLineProtocolWriter
+
+	stats        EndpointStats
+	failures     int
+	ejectedUntil time.Time
+}
+
+// Number of points each endpoint has on the hash ring.
+// More points spread series more evenly among endpoints.
+const ringPointsPerEndpoint = 128
+
+type ringEntry struct {
+	hash  uint32
+	index int
+}
+
+// hashScratch holds the buffers used to split a single write among endpoints.
+type hashScratch struct {
+	healthy []bool
+	bodies  [][]byte
+}
+
+var errNoEndpoints = errors.New("no endpoints to write to")
+
+// NewMultiWriter returns a new MultiWriter that writes to endpoints according to c.
+func NewMultiWriter(endpoints []Endpoint, c MultiWriterConfig) *MultiWriter {
+	if c.MaxFailures <= 0 {
+		c.MaxFailures = 1
+	}
+	if c.EjectFor <= 0 {
+		c.EjectFor = 10 * time.Second
+	}
+
+	w := &MultiWriter{c: c}
+	for i, e := range endpoints {
+		w.endpoints = append(w.endpoints, &endpoint{
+			index: i,
+			w:     WithContext(e.Writer),
+			stats: EndpointStats{Name: e.Name},
+		})
+	}
+
+	if c.Distribution == ConsistentHash {
+		for i, e := range endpoints {
+			for p := 0; p < ringPointsPerEndpoint; p++ {
+				w.ring = append(w.ring, ringEntry{hash: hash32([]byte(e.Name + "#" + strconv.Itoa(p))), index: i})
+			}
+		}
+		sort.Sort(byHash(w.ring))
+
+		n := len(endpoints)
+		w.scratch.New = func() interface{} {
+			return &hashScratch{
+				healthy: make([]bool, n),
+				bodies:  make([][]byte, n),
+			}
+		}
+	}
+
+	return w
+}
+
+// NewMultiHTTPWriter returns a new MultiWriter writing to an HTTPWriter for each of cs,
+// with each endpoint named by its Host.
+func NewMultiHTTPWriter(cs []HTTPWriterConfig, c MultiWriterConfig) *MultiWriter {
+	endpoints := make([]Endpoint, len(cs))
+	for i, hc := range cs {
+		endpoints[i] = Endpoint{Name: hc.Host, Writer: NewHTTPWriter(hc)}
+	}
+	return NewMultiWriter(endpoints, c)
+}
+
+// WriteLineProtocol writes body to one or more endpoints, as configured.
+// It returns the latency in nanoseconds of the entire write, including any failed attempts on other endpoints,
+// and the error from the last attempt.
+func (w *MultiWriter) WriteLineProtocol(body []byte) (int64, error) {
+	return w.WriteLineProtocolContext(context.Background(), body)
+}
+
+// WriteLineProtocolContext is like WriteLineProtocol, but stops trying other endpoints once ctx is done.
+// ctx is also passed to each endpoint's writer, as adapted by WithContext.
+func (w *MultiWriter) WriteLineProtocolContext(ctx context.Context, body []byte) (int64, error) {
+	if len(w.endpoints) == 0 {
+		return 0, errNoEndpoints
+	}
+
+	if w.c.Distribution == ConsistentHash {
+		return w.writeHashed(ctx, body)
+	}
+
+	start := time.Now()
+	var tried []bool
+	var err error
+	for attempt := 0; attempt < len(w.endpoints); attempt++ {
+		e := w.pick(tried)
+
+		var lat int64
+		lat, err = e.w.WriteLineProtocolContext(ctx, body)
+		w.finish(e, lat, err)
+
+		if !endpointFailure(err) || ctx.Err() != nil {
+			break
+		}
+
+		// Only allocate on the failure path.
+		if tried == nil {
+			tried = make([]bool, len(w.endpoints))
+		}
+		tried[e.index] = true
+	}
+
+	return time.Since(start).Nanoseconds(), err
+}
+
+// pick returns the endpoint to write to next, excluding those in tried, if set,
+// and marks the write as outstanding.
+// Ejected endpoints are only picked if every untried endpoint is ejected.
+func (w *MultiWriter) pick(tried []bool) *endpoint {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	now := time.Now()
+	e := w.pickLocked(tried, now, true)
+	if e == nil {
+		e = w.pickLocked(tried, now, false)
+	}
+
+	if w.c.Distribution == RoundRobin {
+		w.next = (e.index + 1) % len(w.endpoints)
+	} else {
+		// Rotate where ties in outstanding writes are broken, to spread them among endpoints.
+		w.next = (w.next + 1) % len(w.endpoints)
+	}
+	e.stats.Outstanding++
+	return e
+}
+
+func (w *MultiWriter) pickLocked(tried []bool, now time.Time, healthyOnly bool) *endpoint {
+	var best *endpoint
+	n := len(w.endpoints)
+	for i := 0; i < n; i++ {
+		e := w.endpoints[(w.next+i)%n]
+		if (tried != nil && tried[e.index]) || (healthyOnly && now.Before(e.ejectedUntil)) {
+			continue
+		}
+
+		if w.c.Distribution == RoundRobin {
+			return e
+		}
+		if best == nil || e.stats.Outstanding < best.stats.Outstanding {
+			best = e
+		}
+	}
+	return best
+}
+
+// finish records the result of a write to e that was marked outstanding,
+// ejecting e if it has failed too many times in a row.
+func (w *MultiWriter) finish(e *endpoint, lat int64, err error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	e.stats.Outstanding--
+	e.stats.Writes++
+	e.stats.LatencyNs += lat
+	if err != nil {
+		e.stats.Errors++
+	}
+
+	if !endpointFailure(err) {
+		e.failures = 0
+		return
+	}
+
+	e.failures++
+	if e.failures >= w.c.MaxFailures {
+		e.failures = 0
+		e.ejectedUntil = time.Now().Add(w.c.EjectFor)
+		e.stats.Ejections++
+	}
+}
+
+// endpointFailure reports whether err suggests that the endpoint that returned it is unhealthy.
+func endpointFailure(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	return Retryable(err)
+}
+
+// writeHashed splits body by series key among the endpoints on the hash ring,
+// and writes each endpoint's share concurrently.
+func (w *MultiWriter) writeHashed(ctx context.Context, body []byte) (int64, error) {
+	s := w.scratch.Get().(*hashScratch)
+	defer w.scratch.Put(s)
+
+	w.mu.Lock()
+	now := time.Now()
+	for i, e := range w.endpoints {
+		s.healthy[i] = !now.Before(e.ejectedUntil)
+	}
+	w.mu.Unlock()
+
+	for i := range s.bodies {
+		s.bodies[i] = s.bodies[i][:0]
+	}
+	for len(body) > 0 {
+		n := canyon.LineEnd(body) + 1
+		if n == 0 {
+			n = len(body)
+		}
+		line := body[:n]
+		body = body[n:]
+
+		i := w.lookup(hash32(seriesKeyOf(line)), s.healthy)
+		s.bodies[i] = append(s.bodies[i], line...)
+	}
+
+	start := time.Now()
+	errs := make([]error, len(w.endpoints))
+	var wg sync.WaitGroup
+	for i, b := range s.bodies {
+		if len(b) == 0 {
+			continue
+		}
+
+		e := w.endpoints[i]
+		w.mu.Lock()
+		e.stats.Outstanding++
+		w.mu.Unlock()
+
+		wg.Add(1)
+		go func(e *endpoint, b []byte) {
+			defer wg.Done()
+			lat, err := e.w.WriteLineProtocolContext(ctx, b)
+			w.finish(e, lat, err)
+			errs[e.index] = err
+		}(e, b)
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return time.Since(start).Nanoseconds(), err
+		}
+	}
+	return time.Since(start).Nanoseconds(), nil
+}
+
+// lookup returns the index of the first healthy endpoint on the hash ring at or after h,
+// or the first endpoint at or after h if none are healthy.
+func (w *MultiWriter) lookup(h uint32, healthy []bool) int {
+	start := sort.Search(len(w.ring), func(i int) bool { return w.ring[i].hash >= h })
+	for i := 0; i < len(w.ring); i++ {
+		if e := w.ring[(start+i)%len(w.ring)]; healthy[e.index] {
+			return e.index
+		}
+	}
+	return w.ring[start%len(w.ring)].index
+}
+
+// Stats returns a snapshot of the stats of each endpoint, in the order the endpoints were given.
+func (w *MultiWriter) Stats() []EndpointStats {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	now := time.Now()
+	stats := make([]EndpointStats, len(w.endpoints))
+	for i, e := range w.endpoints {
+		stats[i] = e.stats
+		stats[i].Ejected = now.Before(e.ejectedUntil)
+	}
+	return stats
+}
+
+// seriesKeyOf returns the series key at the start of line, i.e. everything up to the first unescaped space.
+func seriesKeyOf(line []byte) []byte {
+	for i := 0; i < len(line); i++ {
+		switch line[i] {
+		case '\\':
+			i++
+		case ' ', '\n':
+			return line[:i]
+		}
+	}
+	return line
+}
+
+// hash32 returns the 32-bit FNV-1a hash of b.
+// Unlike hash/fnv, it doesn't allocate.
+func hash32(b []byte) uint32 {
+	const (
+		offset32 = 2166136261
+		prime32  = 16777619
+	)
+	h := uint32(offset32)
+	for _, c := range b {
+		h ^= uint32(c)
+		h *= prime32
+	}
+	return h
+}
+
+type byHash []ringEntry
+
+func (r byHash) Len() int           { return len(r) }
+func (r byHash) Less(i, j int) bool { return r[i].hash < r[j].hash }
+func (r byHash) Swap(i, j int)      { r[i], r[j] = r[j], r[i] }
@@ -0,0 +1,321 @@
+package avalanche_test
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mark-rushakoff/mountainflux/avalanche"
+	"github.com/mark-rushakoff/mountainflux/canyon"
+)
+
+// recordingWriter records every body written to it and returns err.
+// If block is set, writes wait for it to be closed.
+type recordingWriter struct {
+	mu     sync.Mutex
+	bodies []string
+	err    error
+
+	block chan struct{}
+}
+
+func (w *recordingWriter) WriteLineProtocol(body []byte) (int64, error) {
+	if w.block != nil {
+		<-w.block
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.bodies = append(w.bodies, string(body))
+	return 1, w.err
+}
+
+func (w *recordingWriter) writes() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return len(w.bodies)
+}
+
+func (w *recordingWriter) lines() []string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	var lines []string
+	for _, b := range w.bodies {
+		lines = append(lines, strings.Split(strings.TrimSuffix(b, "\n"), "\n")...)
+	}
+	return lines
+}
+
+func newMultiWriter(c avalanche.MultiWriterConfig, ws ...*recordingWriter) *avalanche.MultiWriter {
+	endpoints := make([]avalanche.Endpoint, len(ws))
+	for i, w := range ws {
+		endpoints[i] = avalanche.Endpoint{Name: string(rune('a' + i)), Writer: w}
+	}
+	return avalanche.NewMultiWriter(endpoints, c)
+}
+
+func TestMultiWriter_RoundRobin(t *testing.T) {
+	ws := []*recordingWriter{{}, {}, {}}
+	w := newMultiWriter(avalanche.MultiWriterConfig{}, ws...)
+
+	for i := 0; i < 6; i++ {
+		if _, err := w.WriteLineProtocol([]byte("cpu usage=99")); err != nil {
+			t.Fatalf("expected no error, got: %s", err.Error())
+		}
+	}
+
+	for i, rw := range ws {
+		if n := rw.writes(); n != 2 {
+			t.Errorf("endpoint %d: expected 2 writes, got: %d", i, n)
+		}
+	}
+}
+
+func TestMultiWriter_Failover(t *testing.T) {
+	bad := &recordingWriter{err: temporaryError("connection refused")}
+	good := &recordingWriter{}
+	w := newMultiWriter(avalanche.MultiWriterConfig{EjectFor: 50 * time.Millisecond}, bad, good)
+
+	// The first write fails over from the bad endpoint to the good one, ejecting the bad one.
+	for i := 0; i < 3; i++ {
+		if _, err := w.WriteLineProtocol([]byte("cpu usage=99")); err != nil {
+			t.Fatalf("expected no error, got: %s", err.Error())
+		}
+	}
+	if bad.writes() != 1 || good.writes() != 3 {
+		t.Fatalf("expected 1 write to bad endpoint and 3 to good endpoint, got: %d and %d", bad.writes(), good.writes())
+	}
+
+	stats := w.Stats()
+	exp := avalanche.EndpointStats{Name: "a", Writes: 1, Errors: 1, LatencyNs: 1, Ejections: 1, Ejected: true}
+	if stats[0] != exp {
+		t.Fatalf("got: %+v\nexp: %+v", stats[0], exp)
+	}
+	exp = avalanche.EndpointStats{Name: "b", Writes: 3, LatencyNs: 3}
+	if stats[1] != exp {
+		t.Fatalf("got: %+v\nexp: %+v", stats[1], exp)
+	}
+
+	// Once the ejection expires, the bad endpoint is tried again.
+	time.Sleep(60 * time.Millisecond)
+	if w.Stats()[0].Ejected {
+		t.Fatalf("expected ejection to have expired")
+	}
+	w.WriteLineProtocol([]byte("cpu usage=99"))
+	w.WriteLineProtocol([]byte("cpu usage=99"))
+	if bad.writes() != 2 {
+		t.Fatalf("expected bad endpoint to be retried once, got %d writes", bad.writes())
+	}
+}
+
+func TestMultiWriter_AllEndpointsFail(t *testing.T) {
+	a := &recordingWriter{err: temporaryError("connection refused")}
+	b := &recordingWriter{err: &avalanche.WriteError{StatusCode: http.StatusServiceUnavailable}}
+	w := newMultiWriter(avalanche.MultiWriterConfig{}, a, b)
+
+	_, err := w.WriteLineProtocol([]byte("cpu usage=99"))
+	if _, ok := err.(*avalanche.WriteError); !ok {
+		t.Fatalf("expected last endpoint's error, got: %v", err)
+	}
+
+	// With every endpoint ejected, writes are still attempted.
+	if _, err := w.WriteLineProtocol([]byte("cpu usage=99")); err == nil {
+		t.Fatalf("expected error, got nil")
+	}
+	if a.writes() != 2 || b.writes() != 2 {
+		t.Fatalf("expected 2 writes to each endpoint, got: %d and %d", a.writes(), b.writes())
+	}
+}
+
+func TestMultiWriter_BadRequestDoesNotEject(t *testing.T) {
+	a := &recordingWriter{err: &avalanche.WriteError{StatusCode: http.StatusBadRequest}}
+	b := &recordingWriter{}
+	w := newMultiWriter(avalanche.MultiWriterConfig{}, a, b)
+
+	if _, err := w.WriteLineProtocol([]byte("cpu usage=")); err == nil {
+		t.Fatalf("expected error, got nil")
+	}
+	if b.writes() != 0 {
+		t.Fatalf("expected bad request not to fail over, got %d writes", b.writes())
+	}
+	if s := w.Stats()[0]; s.Ejected || s.Errors != 1 {
+		t.Fatalf("expected 1 error and no ejection, got: %+v", s)
+	}
+}
+
+func TestMultiWriter_WrappedContextErrorDoesNotEject(t *testing.T) {
+	// context.DeadlineExceeded is Temporary, so it would count as a failure if it weren't recognized when wrapped.
+	a := &recordingWriter{err: fmt.Errorf("write aborted: %w", context.DeadlineExceeded)}
+	b := &recordingWriter{}
+	w := newMultiWriter(avalanche.MultiWriterConfig{MaxFailures: 1}, a, b)
+
+	if _, err := w.WriteLineProtocol([]byte("cpu usage=99")); err == nil {
+		t.Fatalf("expected error, got nil")
+	}
+	if b.writes() != 0 {
+		t.Fatalf("expected context error not to fail over, got %d writes", b.writes())
+	}
+	if s := w.Stats()[0]; s.Ejected || s.Ejections != 0 {
+		t.Fatalf("expected no ejection, got: %+v", s)
+	}
+}
+
+func TestMultiWriter_LeastOutstanding(t *testing.T) {
+	slow := &recordingWriter{block: make(chan struct{})}
+	fast := &recordingWriter{}
+	w := newMultiWriter(avalanche.MultiWriterConfig{Distribution: avalanche.LeastOutstanding}, slow, fast)
+
+	// Occupy the slow endpoint; every other write goes to the fast one.
+	done := make(chan struct{})
+	go func() {
+		w.WriteLineProtocol([]byte("cpu usage=99"))
+		close(done)
+	}()
+	for w.Stats()[0].Outstanding == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	for i := 0; i < 5; i++ {
+		w.WriteLineProtocol([]byte("cpu usage=99"))
+	}
+	if n := fast.writes(); n != 5 {
+		t.Fatalf("expected 5 writes to fast endpoint, got: %d", n)
+	}
+
+	close(slow.block)
+	<-done
+	if n := slow.writes(); n != 1 {
+		t.Fatalf("expected 1 write to slow endpoint, got: %d", n)
+	}
+}
+
+func TestMultiWriter_ConsistentHash(t *testing.T) {
+	ws := []*recordingWriter{{}, {}, {}}
+	w := newMultiWriter(avalanche.MultiWriterConfig{Distribution: avalanche.ConsistentHash}, ws...)
+
+	var body []byte
+	var expLines []string
+	for i := 0; i < 100; i++ {
+		line := "cpu,host=h" + string(rune('0'+i%10)) + ",region=r" + string(rune('0'+i/10)) + " usage=99"
+		body = append(body, line+"\n"...)
+		expLines = append(expLines, line)
+	}
+
+	// Write the same lines twice; each series must go to the same endpoint both times.
+	for i := 0; i < 2; i++ {
+		if _, err := w.WriteLineProtocol(body); err != nil {
+			t.Fatalf("expected no error, got: %s", err.Error())
+		}
+	}
+
+	var gotLines []string
+	for i, rw := range ws {
+		lines := rw.lines()
+		if len(lines) == 0 {
+			t.Errorf("endpoint %d: expected some lines, got none", i)
+		}
+		if rw.writes() != 2 {
+			t.Errorf("endpoint %d: expected 2 writes, got: %d", i, rw.writes())
+		}
+
+		counts := make(map[string]int)
+		for _, l := range lines {
+			counts[l]++
+		}
+		for l, n := range counts {
+			if n != 2 {
+				t.Errorf("endpoint %d: expected line %q twice, got %d times", i, l, n)
+			}
+		}
+		gotLines = append(gotLines, lines...)
+	}
+
+	// Every line was written exactly twice, across all endpoints.
+	sort.Strings(gotLines)
+	var exp []string
+	for _, l := range expLines {
+		exp = append(exp, l, l)
+	}
+	sort.Strings(exp)
+	if strings.Join(gotLines, "\n") != strings.Join(exp, "\n") {
+		t.Fatalf("expected every line to be written twice")
+	}
+}
+
+func TestMultiWriter_ConsistentHashMultilineStrings(t *testing.T) {
+	ws := []*recordingWriter{{}, {}, {}}
+	w := newMultiWriter(avalanche.MultiWriterConfig{Distribution: avalanche.ConsistentHash}, ws...)
+
+	var body []byte
+	var expLines []string
+	for i := 0; i < 20; i++ {
+		line := "cpu,host=h" + string(rune('A'+i)) + " s=\"line1\nzz more\" 1"
+		body = append(body, line+"\n"...)
+		expLines = append(expLines, line)
+	}
+	if _, err := w.WriteLineProtocol(body); err != nil {
+		t.Fatalf("expected no error, got: %s", err.Error())
+	}
+
+	// Each line must arrive whole, newline and all, at a single endpoint.
+	var gotLines []string
+	for _, rw := range ws {
+		for _, b := range rw.bodies {
+			s := bufio.NewScanner(strings.NewReader(b))
+			s.Split(canyon.ScanLines)
+			for s.Scan() {
+				gotLines = append(gotLines, s.Text())
+			}
+		}
+	}
+	sort.Strings(gotLines)
+	if !reflect.DeepEqual(gotLines, expLines) {
+		t.Fatalf("got: %q, exp: %q", gotLines, expLines)
+	}
+}
+
+func TestMultiWriter_ConsistentHashEjection(t *testing.T) {
+	a := &recordingWriter{err: temporaryError("connection refused")}
+	b := &recordingWriter{}
+	w := newMultiWriter(avalanche.MultiWriterConfig{Distribution: avalanche.ConsistentHash}, a, b)
+
+	var body []byte
+	for i := 0; i < 50; i++ {
+		body = append(body, "cpu,host=h"+string(rune('A'+i))+" usage=99\n"...)
+	}
+
+	// The first write fails on a, ejecting it; the next sends every series to b.
+	if _, err := w.WriteLineProtocol(body); err == nil {
+		t.Fatalf("expected error, got nil")
+	}
+	if _, err := w.WriteLineProtocol(body); err != nil {
+		t.Fatalf("expected no error, got: %s", err.Error())
+	}
+	if a.writes() != 1 {
+		t.Fatalf("expected 1 write to a, got: %d", a.writes())
+	}
+	if n := len(b.lines()); n <= 50 {
+		t.Fatalf("expected b to receive a's series after ejection, got %d lines", n)
+	}
+}
+
+func TestParseDistribution(t *testing.T) {
+	for _, d := range []avalanche.Distribution{avalanche.RoundRobin, avalanche.LeastOutstanding, avalanche.ConsistentHash} {
+		got, err := avalanche.ParseDistribution(d.String())
+		if err != nil || got != d {
+			t.Errorf("%s: got %v, %v", d, got, err)
+		}
+	}
+
+	if _, err := avalanche.ParseDistribution("random"); err == nil {
+		t.Errorf("expected error for unknown distribution")
+	}
+}
@@ -0,0 +1,152 @@
+package avalanche
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/mark-rushakoff/mountainflux/canyon"
+)
+
+// RateLimitConfig is the configuration used to create a RateLimiter.
+// Either or both limits may be set; a limit of 0 means unlimited.
+type RateLimitConfig struct {
+	// Maximum number of lines written per second.
+	LinesPerSecond float64
+
+	// Maximum number of bytes of line protocol written per second.
+	// Bytes are counted before any compression.
+	BytesPerSecond float64
+
+	// How much unused capacity may accumulate while writers are idle,
+	// expressed as time at the configured rates.
+	// Larger values allow larger bursts after a pause; smaller values keep the offered load steadier.
+	// Defaults to 100ms.
+	Burst time.Duration
+}
+
+// RateLimiter is a token bucket that caps the throughput of every RateLimitedWriter sharing it.
+// A RateLimiter is safe for concurrent use.
+type RateLimiter struct {
+	mu    sync.Mutex
+	lines tokenBucket
+	bytes tokenBucket
+}
+
+// NewRateLimiter returns a new RateLimiter enforcing the limits in c.
+func NewRateLimiter(c RateLimitConfig) *RateLimiter {
+	if c.Burst <= 0 {
+		c.Burst = 100 * time.Millisecond
+	}
+
+	now := time.Now()
+	return &RateLimiter{
+		lines: newTokenBucket(c.LinesPerSecond, c.Burst, now),
+		bytes: newTokenBucket(c.BytesPerSecond, c.Burst, now),
+	}
+}
+
+// Wait blocks until the given number of lines and bytes may be written,
+// or until ctx is done, in which case it returns ctx.Err().
+//
+// Requests larger than the burst size are allowed; they are paid back by delaying later requests.
+// Capacity reserved by a call that returns early because of ctx is not given back.
+func (l *RateLimiter) Wait(ctx context.Context, numLines, numBytes int) error {
+	now := time.Now()
+
+	l.mu.Lock()
+	d := l.lines.reserve(now, float64(numLines))
+	if bd := l.bytes.reserve(now, float64(numBytes)); bd > d {
+		d = bd
+	}
+	l.mu.Unlock()
+
+	if d <= 0 {
+		return ctx.Err()
+	}
+
+	t := time.NewTimer(d)
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		t.Stop()
+		return ctx.Err()
+	}
+}
+
+// tokenBucket tracks the tokens available at a fixed refill rate.
+// Tokens may go negative, in which case callers wait until the debt is repaid.
+type tokenBucket struct {
+	// Tokens per second, or 0 if unlimited.
+	rate float64
+
+	// Maximum number of tokens, i.e. the largest burst allowed after idling.
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(rate float64, burst time.Duration, now time.Time) tokenBucket {
+	n := rate * burst.Seconds()
+	return tokenBucket{
+		rate:   rate,
+		burst:  n,
+		tokens: n,
+		last:   now,
+	}
+}
+
+// reserve takes n tokens from b, returning how long the caller must wait before they may be used.
+func (b *tokenBucket) reserve(now time.Time, n float64) time.Duration {
+	if b.rate <= 0 {
+		return 0
+	}
+
+	if now.After(b.last) {
+		b.tokens += now.Sub(b.last).Seconds() * b.rate
+		if b.tokens > b.burst {
+			b.tokens = b.burst
+		}
+		b.last = now
+	}
+
+	b.tokens -= n
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / b.rate * float64(time.Second))
+}
+
+// RateLimitedWriter is a LineProtocolWriter that waits on a RateLimiter before each write
+// to an underlying LineProtocolWriter.
+// Share one RateLimiter between many RateLimitedWriters to cap their combined throughput.
+type RateLimitedWriter struct {
+	w LineProtocolWriter
+	l *RateLimiter
+}
+
+var (
+	_ LineProtocolWriter        = (*RateLimitedWriter)(nil)
+	_ ContextLineProtocolWriter = (*RateLimitedWriter)(nil)
+)
+
+// NewRateLimitedWriter returns a new RateLimitedWriter that writes to w, limited by l.
+func NewRateLimitedWriter(w LineProtocolWriter, l *RateLimiter) *RateLimitedWriter {
+	return &RateLimitedWriter{w: w, l: l}
+}
+
+// WriteLineProtocol waits until the rate limit allows body to be written, then writes it to the underlying writer.
+// The returned latency is that of the underlying write alone, excluding time spent waiting on the rate limit.
+func (w *RateLimitedWriter) WriteLineProtocol(body []byte) (int64, error) {
+	return w.WriteLineProtocolContext(context.Background(), body)
+}
+
+// WriteLineProtocolContext is like WriteLineProtocol, but stops waiting on the rate limit once ctx is done.
+// ctx is also passed to the underlying writer, as adapted by WithContext.
+func (w *RateLimitedWriter) WriteLineProtocolContext(ctx context.Context, body []byte) (int64, error) {
+	if err := w.l.Wait(ctx, canyon.CountLines(body), len(body)); err != nil {
+		return 0, err
+	}
+	return WithContext(w.w).WriteLineProtocolContext(ctx, body)
+}
@@ -0,0 +1,87 @@
+package avalanche_test
+
+import (
+	"bytes"
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mark-rushakoff/mountainflux/avalanche"
+)
+
+func TestRateLimitedWriter_LinesPerSecond(t *testing.T) {
+	sw := &scriptedWriter{}
+	w := avalanche.NewRateLimitedWriter(sw, avalanche.NewRateLimiter(avalanche.RateLimitConfig{
+		LinesPerSecond: 1000,
+		Burst:          10 * time.Millisecond,
+	}))
+
+	// 60 lines at 1000 lines/sec, with the first 10 covered by the burst, takes at least 50ms.
+	body := bytes.Repeat([]byte("cpu usage=99\n"), 10)
+	start := time.Now()
+	for i := 0; i < 6; i++ {
+		if _, err := w.WriteLineProtocol(body); err != nil {
+			t.Fatalf("expected no error, got: %s", err.Error())
+		}
+	}
+	elapsed := time.Since(start)
+
+	if sw.writes != 6 {
+		t.Fatalf("expected 6 writes, got: %d", sw.writes)
+	}
+	if elapsed < 45*time.Millisecond || elapsed > time.Second {
+		t.Fatalf("expected writes to take about 50ms, took %v", elapsed)
+	}
+}
+
+func TestRateLimitedWriter_SharedBytesPerSecond(t *testing.T) {
+	l := avalanche.NewRateLimiter(avalanche.RateLimitConfig{
+		BytesPerSecond: 10000,
+		Burst:          10 * time.Millisecond,
+	})
+
+	// 4 writers each writing 500 bytes share 10000 bytes/sec;
+	// with the first 100 bytes covered by the burst, that takes at least 190ms.
+	body := bytes.Repeat([]byte("x"), 100)
+	start := time.Now()
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			w := avalanche.NewRateLimitedWriter(&scriptedWriter{}, l)
+			for j := 0; j < 5; j++ {
+				if _, err := w.WriteLineProtocol(body); err != nil {
+					t.Errorf("expected no error, got: %s", err.Error())
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	if elapsed := time.Since(start); elapsed < 180*time.Millisecond || elapsed > 2*time.Second {
+		t.Fatalf("expected writes to take about 190ms, took %v", elapsed)
+	}
+}
+
+func TestRateLimitedWriter_Context(t *testing.T) {
+	sw := &scriptedWriter{}
+	w := avalanche.NewRateLimitedWriter(sw, avalanche.NewRateLimiter(avalanche.RateLimitConfig{
+		LinesPerSecond: 1,
+		Burst:          time.Second,
+	}))
+
+	// The first line is allowed immediately; the next would wait for about a second.
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := w.WriteLineProtocolContext(ctx, []byte("cpu usage=99")); err != nil {
+		t.Fatalf("expected no error, got: %s", err.Error())
+	}
+	if _, err := w.WriteLineProtocolContext(ctx, []byte("cpu usage=99")); err != context.DeadlineExceeded {
+		t.Fatalf("expected context.DeadlineExceeded, got: %v", err)
+	}
+	if sw.writes != 1 {
+		t.Fatalf("expected 1 write, got: %d", sw.writes)
+	}
+}
@@ -0,0 +1,141 @@
+package avalanche
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"time"
+)
+
+// RetryConfig is the configuration used to create a RetryWriter.
+type RetryConfig struct {
+	// Maximum number of attempts per write, including the first.
+	// Defaults to 3.
+	MaxAttempts int
+
+	// Time to wait before the first retry.
+	// Defaults to 100ms.
+	InitialBackoff time.Duration
+
+	// Upper bound on the time to wait between attempts, before jitter.
+	// A server's Retry-After may still ask for a longer wait, which is honoured.
+	// Defaults to 10s.
+	MaxBackoff time.Duration
+
+	// Factor by which the backoff grows after each retry.
+	// Defaults to 2.
+	Multiplier float64
+
+	// Fraction, from 0 to 1, by which each backoff is randomly adjusted up or down,
+	// so that many writers failing at once don't retry in lockstep.
+	// Values outside that range are clamped to it.
+	// Defaults to 0, i.e. no jitter.
+	Jitter float64
+
+	// If set, OnAttempt is called after every attempt with the attempt number (starting at 1),
+	// that attempt's latency in nanoseconds, and its error.
+	OnAttempt func(attempt int, latencyNs int64, err error)
+}
+
+// RetryWriter is a LineProtocolWriter that retries failed writes of an underlying LineProtocolWriter,
+// with exponential backoff and jitter.
+//
+// Only Retryable errors are retried: HTTPWriter's transport errors, and *WriteErrors that are Temporary, such as 5xx and 429 responses.
+// Other errors, such as 400 partial writes, are returned immediately.
+type RetryWriter struct {
+	w LineProtocolWriter
+	c RetryConfig
+}
+
+var (
+	_ LineProtocolWriter        = (*RetryWriter)(nil)
+	_ ContextLineProtocolWriter = (*RetryWriter)(nil)
+)
+
+// NewRetryWriter returns a new RetryWriter that writes to w according to c.
+func NewRetryWriter(w LineProtocolWriter, c RetryConfig) *RetryWriter {
+	if c.MaxAttempts <= 0 {
+		c.MaxAttempts = 3
+	}
+	if c.InitialBackoff <= 0 {
+		c.InitialBackoff = 100 * time.Millisecond
+	}
+	if c.MaxBackoff <= 0 {
+		c.MaxBackoff = 10 * time.Second
+	}
+	if c.Multiplier < 1 {
+		c.Multiplier = 2
+	}
+	if c.Jitter < 0 {
+		c.Jitter = 0
+	} else if c.Jitter > 1 {
+		c.Jitter = 1
+	}
+
+	return &RetryWriter{w: w, c: c}
+}
+
+// WriteLineProtocol writes body to the underlying LineProtocolWriter, retrying as configured.
+// It returns the latency in nanoseconds from the start of the first attempt to the end of the last,
+// including time spent waiting between attempts, and the error from the last attempt.
+// Use RetryConfig.OnAttempt to observe the latency of each attempt.
+func (w *RetryWriter) WriteLineProtocol(body []byte) (int64, error) {
+	return w.WriteLineProtocolContext(context.Background(), body)
+}
+
+// WriteLineProtocolContext is like WriteLineProtocol, but stops retrying once ctx is done.
+// ctx is also passed to the underlying writer, as adapted by WithContext.
+func (w *RetryWriter) WriteLineProtocolContext(ctx context.Context, body []byte) (int64, error) {
+	start := time.Now()
+	backoff := w.c.InitialBackoff
+	cw := WithContext(w.w)
+
+	for attempt := 1; ; attempt++ {
+		lat, err := cw.WriteLineProtocolContext(ctx, body)
+		if w.c.OnAttempt != nil {
+			w.c.OnAttempt(attempt, lat, err)
+		}
+
+		if err == nil || attempt >= w.c.MaxAttempts || !Retryable(err) || ctx.Err() != nil {
+			return time.Since(start).Nanoseconds(), err
+		}
+
+		t := time.NewTimer(w.wait(backoff, err))
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			t.Stop()
+			return time.Since(start).Nanoseconds(), ctx.Err()
+		}
+
+		backoff = time.Duration(float64(backoff) * w.c.Multiplier)
+		if backoff > w.c.MaxBackoff {
+			backoff = w.c.MaxBackoff
+		}
+	}
+}
+
+// wait returns how long to wait before retrying after err, given the current backoff.
+func (w *RetryWriter) wait(backoff time.Duration, err error) time.Duration {
+	d := backoff
+	if w.c.Jitter > 0 {
+		d = time.Duration(float64(d) * (1 + w.c.Jitter*(2*rand.Float64()-1)))
+	}
+
+	if we, ok := err.(*WriteError); ok && we.RetryAfter > d {
+		d = we.RetryAfter
+	}
+
+	return d
+}
+
+// Retryable reports whether err, as returned from a LineProtocolWriter, may succeed if the write is retried.
+// An error is retryable only if it has a Temporary method that returns true,
+// as HTTPWriter's transport errors and *WriteErrors for 5xx and 429 responses do.
+// Any other error, such as a *ConfigError or an *OversizeError, is permanent.
+func Retryable(err error) bool {
+	var t interface {
+		Temporary() bool
+	}
+	return errors.As(err, &t) && t.Temporary()
+}
@@ -0,0 +1,166 @@
+package avalanche_test
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/mark-rushakoff/mountainflux/avalanche"
+)
+
+// scriptedWriter returns the next error in errs on each write, then nil once errs is exhausted.
+type scriptedWriter struct {
+	errs   []error
+	writes int
+}
+
+func (w *scriptedWriter) WriteLineProtocol(body []byte) (int64, error) {
+	w.writes++
+	if len(w.errs) == 0 {
+		return 1, nil
+	}
+
+	err := w.errs[0]
+	w.errs = w.errs[1:]
+	return 1, err
+}
+
+// temporaryError is a retryable error, like HTTPWriter's transport errors.
+type temporaryError string
+
+func (e temporaryError) Error() string   { return string(e) }
+func (e temporaryError) Temporary() bool { return true }
+
+var retryTests = []struct {
+	name      string
+	errs      []error
+	expWrites int
+	expErr    bool
+}{
+	{"success", nil, 1, false},
+	{"transport error then success", []error{temporaryError("connection refused")}, 2, false},
+	{"permanent error is not retried", []error{errors.New("disk full")}, 1, true},
+	{"oversize lines are not retried", []error{&avalanche.OversizeError{Skipped: 1, PayloadSize: 32}}, 1, true},
+	{"config error is not retried", []error{&avalanche.ConfigError{Err: errors.New("bad gzip level")}}, 1, true},
+	{"503 then 429 then success", []error{
+		&avalanche.WriteError{StatusCode: http.StatusServiceUnavailable},
+		&avalanche.WriteError{StatusCode: http.StatusTooManyRequests},
+	}, 3, false},
+	{"partial write is not retried", []error{&avalanche.WriteError{StatusCode: http.StatusBadRequest}}, 1, true},
+	{"404 is not retried", []error{&avalanche.WriteError{StatusCode: http.StatusNotFound}}, 1, true},
+	{"gives up after max attempts", []error{
+		&avalanche.WriteError{StatusCode: http.StatusInternalServerError},
+		&avalanche.WriteError{StatusCode: http.StatusInternalServerError},
+		&avalanche.WriteError{StatusCode: http.StatusInternalServerError},
+		&avalanche.WriteError{StatusCode: http.StatusInternalServerError},
+	}, 3, true},
+}
+
+func TestRetryWriter(t *testing.T) {
+	for _, rt := range retryTests {
+		sw := &scriptedWriter{errs: rt.errs}
+
+		var attempts []int
+		w := avalanche.NewRetryWriter(sw, avalanche.RetryConfig{
+			MaxAttempts:    3,
+			InitialBackoff: time.Millisecond,
+			Jitter:         0.5,
+			OnAttempt: func(attempt int, latNs int64, err error) {
+				attempts = append(attempts, attempt)
+			},
+		})
+
+		_, err := w.WriteLineProtocol([]byte("cpu usage=99"))
+		if (err != nil) != rt.expErr {
+			t.Errorf("%s: exp error: %v, got: %v", rt.name, rt.expErr, err)
+		}
+		if sw.writes != rt.expWrites {
+			t.Errorf("%s: exp %d writes, got: %d", rt.name, rt.expWrites, sw.writes)
+		}
+		if len(attempts) != rt.expWrites || attempts[len(attempts)-1] != rt.expWrites {
+			t.Errorf("%s: exp attempts 1 through %d to be reported, got: %v", rt.name, rt.expWrites, attempts)
+		}
+	}
+}
+
+func TestRetryWriter_HonoursRetryAfter(t *testing.T) {
+	sw := &scriptedWriter{errs: []error{
+		&avalanche.WriteError{StatusCode: http.StatusServiceUnavailable, RetryAfter: 50 * time.Millisecond},
+	}}
+	w := avalanche.NewRetryWriter(sw, avalanche.RetryConfig{InitialBackoff: time.Millisecond})
+
+	lat, err := w.WriteLineProtocol([]byte("cpu usage=99"))
+	if err != nil {
+		t.Fatalf("expected no error, got: %s", err.Error())
+	}
+	if lat < (50 * time.Millisecond).Nanoseconds() {
+		t.Fatalf("expected to wait at least 50ms before retrying, total latency was %v", time.Duration(lat))
+	}
+}
+
+func TestHTTPWriter_RetryAfter(t *testing.T) {
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "7")
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+	s := httptest.NewServer(h)
+	defer s.Close()
+
+	w := avalanche.NewHTTPWriter(avalanche.HTTPWriterConfig{
+		Host:     s.URL,
+		Database: "mydb",
+	})
+	_, err := w.WriteLineProtocol([]byte("cpu usage=99"))
+	we, ok := err.(*avalanche.WriteError)
+	if !ok {
+		t.Fatalf("expected *WriteError, got: %v", err)
+	}
+	if we.StatusCode != http.StatusServiceUnavailable || we.RetryAfter != 7*time.Second || !we.Temporary() {
+		t.Fatalf("unexpected error: %#v", we)
+	}
+}
+
+func TestHTTPWriter_TransportErrorRetryable(t *testing.T) {
+	// Find a port that refuses connections.
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("expected no error, got: %s", err.Error())
+	}
+	addr := l.Addr().String()
+	l.Close()
+
+	w := avalanche.NewHTTPWriter(avalanche.HTTPWriterConfig{
+		Host:     "http://" + addr,
+		Database: "mydb",
+	})
+	_, err = w.WriteLineProtocol([]byte("cpu usage=99"))
+	if err == nil {
+		t.Fatalf("expected error for refused connection, got nil")
+	}
+	if !avalanche.Retryable(err) {
+		t.Fatalf("expected refused connection to be retryable, got: %v", err)
+	}
+	if c := avalanche.Categorize(err); c != avalanche.CategoryTransportError {
+		t.Fatalf("expected category %q, got: %q", avalanche.CategoryTransportError, c)
+	}
+}
+
+func TestHTTPWriter_ConfigErrorNotRetryable(t *testing.T) {
+	w := avalanche.NewHTTPWriter(avalanche.HTTPWriterConfig{
+		Host:      "http://127.0.0.1:0",
+		Database:  "mydb",
+		Gzip:      true,
+		GzipLevel: 100,
+	})
+
+	_, err := w.WriteLineProtocol([]byte("cpu usage=99"))
+	if _, ok := err.(*avalanche.ConfigError); !ok {
+		t.Fatalf("expected *ConfigError, got: %v", err)
+	}
+	if avalanche.Retryable(err) {
+		t.Fatalf("expected config error not to be retryable")
+	}
+}
@@ -0,0 +1,70 @@
+package avalanche
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Schedule hands out send times on a fixed schedule, one every interval, for open-loop benchmarks.
+//
+// When writes are sent as soon as a writer is free, a slow server delays the writes behind it,
+// which silently lowers the offered load and hides those delays from the measured latency.
+// When writes are instead due at scheduled times, regardless of how the server responds,
+// measuring each write's latency from its scheduled time counts any time it spent waiting for a free writer against the server.
+//
+// A Schedule is safe for concurrent use.
+type Schedule struct {
+	interval time.Duration
+
+	mu sync.Mutex
+
+	// Next send time to hand out, or zero before the first call to Next.
+	next time.Time
+}
+
+// NewSchedule returns a new Schedule with send times interval apart, which must be positive.
+func NewSchedule(interval time.Duration) *Schedule {
+	return &Schedule{interval: interval}
+}
+
+// Next reserves the next send time on the schedule, waits until it arrives, and returns it.
+// The first send time is when Next is first called.
+//
+// If the send time has already passed, because the caller has fallen behind, Next returns it immediately:
+// the schedule does not slow down for the caller.
+// If ctx is done first, Next returns ctx.Err(), and the reserved send time is skipped.
+func (s *Schedule) Next(ctx context.Context) (time.Time, error) {
+	s.mu.Lock()
+	now := time.Now()
+	if s.next.IsZero() {
+		s.next = now
+	}
+	t := s.next
+	s.next = s.next.Add(s.interval)
+	s.mu.Unlock()
+
+	if d := t.Sub(now); d > 0 {
+		timer := time.NewTimer(d)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return t, ctx.Err()
+		}
+	}
+
+	return t, nil
+}
+
+// Stall pushes the schedule back to start from now, if it has fallen behind.
+// Call Stall when writes are late for reasons that shouldn't count against the server,
+// such as waiting on input, so that the schedule doesn't then hand out a burst of past send times.
+func (s *Schedule) Stall() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if now := time.Now(); !s.next.IsZero() && now.After(s.next) {
+		s.next = now
+	}
+}
@@ -0,0 +1,79 @@
+package avalanche_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/mark-rushakoff/mountainflux/avalanche"
+)
+
+func TestSchedule_SlowWriterAddsLatency(t *testing.T) {
+	const (
+		interval = 5 * time.Millisecond
+		writeLat = 20 * time.Millisecond
+		n        = 5
+	)
+	s := avalanche.NewSchedule(interval)
+
+	// A single writer, four times slower than the schedule.
+	var scheduled []time.Time
+	var lats []time.Duration
+	for i := 0; i < n; i++ {
+		st, err := s.Next(context.Background())
+		if err != nil {
+			t.Fatalf("expected no error, got: %s", err.Error())
+		}
+		time.Sleep(writeLat)
+
+		scheduled = append(scheduled, st)
+		lats = append(lats, time.Since(st))
+	}
+
+	// The offered rate doesn't drop to match the writer...
+	for i := range scheduled {
+		if exp := scheduled[0].Add(time.Duration(i) * interval); !scheduled[i].Equal(exp) {
+			t.Fatalf("expected send time %d to be %v after the first, got: %v", i, exp.Sub(scheduled[0]), scheduled[i].Sub(scheduled[0]))
+		}
+	}
+
+	// ...so each write's latency includes the time it waited for the writes before it.
+	for i, lat := range lats {
+		if exp := time.Duration(i+1)*writeLat - time.Duration(i)*interval; lat < exp {
+			t.Fatalf("expected latency of write %d to be at least %v, got: %v", i, exp, lat)
+		}
+	}
+}
+
+func TestSchedule_Stall(t *testing.T) {
+	s := avalanche.NewSchedule(time.Millisecond)
+	if _, err := s.Next(context.Background()); err != nil {
+		t.Fatalf("expected no error, got: %s", err.Error())
+	}
+
+	// Waiting on input puts the schedule behind, which Stall forgives.
+	time.Sleep(20 * time.Millisecond)
+	stalled := time.Now()
+	s.Stall()
+
+	st, err := s.Next(context.Background())
+	if err != nil {
+		t.Fatalf("expected no error, got: %s", err.Error())
+	}
+	if st.Before(stalled) {
+		t.Fatalf("expected schedule to resume after stall, got send time %v before it", stalled.Sub(st))
+	}
+}
+
+func TestSchedule_Context(t *testing.T) {
+	s := avalanche.NewSchedule(time.Hour)
+	if _, err := s.Next(context.Background()); err != nil {
+		t.Fatalf("expected no error, got: %s", err.Error())
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := s.Next(ctx); err != context.Canceled {
+		t.Fatalf("expected %v, got: %v", context.Canceled, err)
+	}
+}
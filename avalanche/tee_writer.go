@@ -0,0 +1,88 @@
+package avalanche
+
+import (
+	"context"
+	"sync"
+)
+
+// TeeResult is the outcome of writing to a single target of a TeeWriter.
+type TeeResult struct {
+	// Latency in nanoseconds of the write to the target, as returned by the target's writer.
+	LatencyNs int64
+
+	Err error
+}
+
+// TeeWriter is a LineProtocolWriter that writes every body to each of several targets concurrently,
+// e.g. to mirror a workload to a real InfluxDB server and to chasm.
+// Use Tee to get the latency and error of each target.
+//
+// A TeeWriter is safe for concurrent use if its targets are.
+type TeeWriter struct {
+	targets []ContextLineProtocolWriter
+}
+
+var (
+	_ LineProtocolWriter        = (*TeeWriter)(nil)
+	_ ContextLineProtocolWriter = (*TeeWriter)(nil)
+)
+
+// NewTeeWriter returns a new TeeWriter that writes to each of targets.
+func NewTeeWriter(targets ...LineProtocolWriter) *TeeWriter {
+	w := &TeeWriter{targets: make([]ContextLineProtocolWriter, len(targets))}
+	for i, t := range targets {
+		w.targets[i] = WithContext(t)
+	}
+	return w
+}
+
+// Tee writes body to every target concurrently and waits for all of them to finish.
+// It appends the result of each write to dst, in the order the targets were given, and returns the extended slice.
+// Pass a reused dst[:0] to avoid allocating results on every write.
+func (w *TeeWriter) Tee(ctx context.Context, body []byte, dst []TeeResult) []TeeResult {
+	start := len(dst)
+	for range w.targets {
+		dst = append(dst, TeeResult{})
+	}
+	results := dst[start:]
+
+	if len(w.targets) == 0 {
+		return dst
+	}
+
+	// Write to the last target on this goroutine, rather than idling while the others finish.
+	var wg sync.WaitGroup
+	last := len(w.targets) - 1
+	for i, t := range w.targets[:last] {
+		wg.Add(1)
+		go func(i int, t ContextLineProtocolWriter) {
+			defer wg.Done()
+			results[i].LatencyNs, results[i].Err = t.WriteLineProtocolContext(ctx, body)
+		}(i, t)
+	}
+	results[last].LatencyNs, results[last].Err = w.targets[last].WriteLineProtocolContext(ctx, body)
+	wg.Wait()
+
+	return dst
+}
+
+// WriteLineProtocol writes body to every target concurrently.
+// It returns the latency of the slowest target and the error of the first target that failed, in the order the targets were given.
+func (w *TeeWriter) WriteLineProtocol(body []byte) (int64, error) {
+	return w.WriteLineProtocolContext(context.Background(), body)
+}
+
+// WriteLineProtocolContext is like WriteLineProtocol, but passes ctx to each target's writer, as adapted by WithContext.
+func (w *TeeWriter) WriteLineProtocolContext(ctx context.Context, body []byte) (int64, error) {
+	var lat int64
+	var err error
+	for _, r := range w.Tee(ctx, body, nil) {
+		if r.LatencyNs > lat {
+			lat = r.LatencyNs
+		}
+		if err == nil {
+			err = r.Err
+		}
+	}
+	return lat, err
+}
@@ -0,0 +1,99 @@
+package avalanche_test
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/mark-rushakoff/mountainflux/avalanche"
+)
+
+// latencyWriter sleeps for latency, then reports it and returns err.
+type latencyWriter struct {
+	latency time.Duration
+	err     error
+}
+
+func (w latencyWriter) WriteLineProtocol(body []byte) (int64, error) {
+	time.Sleep(w.latency)
+	return int64(w.latency), w.err
+}
+
+// gateWriter signals on started when a write begins, then blocks until release is closed,
+// before reporting latency and returning err.
+type gateWriter struct {
+	started chan<- struct{}
+	release <-chan struct{}
+
+	latency time.Duration
+	err     error
+}
+
+func (w gateWriter) WriteLineProtocol(body []byte) (int64, error) {
+	w.started <- struct{}{}
+	<-w.release
+	return int64(w.latency), w.err
+}
+
+func TestTeeWriter_Tee(t *testing.T) {
+	errTarget := errors.New("connection refused")
+	started := make(chan struct{}, 4)
+	release := make(chan struct{})
+	a := &recordingWriter{}
+	b := gateWriter{started: started, release: release, latency: 50 * time.Millisecond}
+	c := gateWriter{started: started, release: release, latency: 50 * time.Millisecond, err: errTarget}
+	w := avalanche.NewTeeWriter(a, b, c)
+
+	done := make(chan []avalanche.TeeResult)
+	go func() {
+		done <- w.Tee(context.Background(), []byte("cpu usage=99"), nil)
+	}()
+
+	// Neither gated target finishes until both have started, so both must be written concurrently.
+	for i := 0; i < 2; i++ {
+		select {
+		case <-started:
+		case <-time.After(10 * time.Second):
+			t.Fatalf("expected targets to be written concurrently, but only %d of 2 started", i)
+		}
+	}
+	close(release)
+	results := <-done
+
+	exp := []avalanche.TeeResult{
+		{LatencyNs: 1},
+		{LatencyNs: int64(50 * time.Millisecond)},
+		{LatencyNs: int64(50 * time.Millisecond), Err: errTarget},
+	}
+	if !reflect.DeepEqual(results, exp) {
+		t.Fatalf("got: %+v\nexp: %+v", results, exp)
+	}
+	if got := a.lines(); !reflect.DeepEqual(got, []string{"cpu usage=99"}) {
+		t.Fatalf("got: %v, exp: [cpu usage=99]", got)
+	}
+
+	// Results are appended to dst.
+	results = w.Tee(context.Background(), []byte("cpu usage=99"), results[:1])
+	if len(results) != 4 || results[1].LatencyNs != 1 {
+		t.Fatalf("expected results to be appended, got: %+v", results)
+	}
+}
+
+func TestTeeWriter_WriteLineProtocol(t *testing.T) {
+	errTarget := errors.New("connection refused")
+	w := avalanche.NewTeeWriter(
+		latencyWriter{latency: 10 * time.Millisecond},
+		latencyWriter{latency: 30 * time.Millisecond, err: errTarget},
+		latencyWriter{latency: 20 * time.Millisecond, err: errors.New("another error")},
+	)
+
+	lat, err := w.WriteLineProtocol([]byte("cpu usage=99"))
+	if lat != int64(30*time.Millisecond) {
+		t.Fatalf("expected latency of slowest target, got: %v", time.Duration(lat))
+	}
+	if err != errTarget {
+		t.Fatalf("expected error of first failing target, got: %v", err)
+	}
+}
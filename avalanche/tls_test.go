@@ -0,0 +1,188 @@
+package avalanche_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mark-rushakoff/mountainflux/avalanche"
+	"github.com/mark-rushakoff/mountainflux/chasm"
+)
+
+// testCerts holds the paths to a self-signed CA and server and client certificates signed by it.
+type testCerts struct {
+	caFile string
+
+	serverCertFile, serverKeyFile string
+	clientCertFile, clientKeyFile string
+}
+
+// writeTestCerts generates testCerts in dir.
+func writeTestCerts(t *testing.T, dir string) testCerts {
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caTmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "avalanche test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTmpl, caTmpl, &caKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca, err := x509.ParseCertificate(caDER)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := testCerts{
+		caFile:         filepath.Join(dir, "ca.pem"),
+		serverCertFile: filepath.Join(dir, "server.pem"),
+		serverKeyFile:  filepath.Join(dir, "server-key.pem"),
+		clientCertFile: filepath.Join(dir, "client.pem"),
+		clientKeyFile:  filepath.Join(dir, "client-key.pem"),
+	}
+	writePEM(t, c.caFile, "CERTIFICATE", caDER)
+
+	leaf := func(serial int64, usage x509.ExtKeyUsage, certFile, keyFile string) {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tmpl := &x509.Certificate{
+			SerialNumber: big.NewInt(serial),
+			Subject:      pkix.Name{CommonName: "localhost"},
+			NotBefore:    time.Now().Add(-time.Hour),
+			NotAfter:     time.Now().Add(time.Hour),
+			KeyUsage:     x509.KeyUsageDigitalSignature,
+			ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+			DNSNames:     []string{"localhost"},
+			IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback},
+		}
+		der, err := x509.CreateCertificate(rand.Reader, tmpl, ca, &key.PublicKey, caKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		keyDER, err := x509.MarshalECPrivateKey(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		writePEM(t, certFile, "CERTIFICATE", der)
+		writePEM(t, keyFile, "EC PRIVATE KEY", keyDER)
+	}
+	leaf(2, x509.ExtKeyUsageServerAuth, c.serverCertFile, c.serverKeyFile)
+	leaf(3, x509.ExtKeyUsageClientAuth, c.clientCertFile, c.clientKeyFile)
+
+	return c
+}
+
+func writePEM(t *testing.T, path, typ string, der []byte) {
+	b := pem.EncodeToMemory(&pem.Block{Type: typ, Bytes: der})
+	if err := ioutil.WriteFile(path, b, 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// startTLSChasm starts a chasm server serving TLS with the given config, returning its URL and a function to close it.
+func startTLSChasm(t *testing.T, c chasm.HTTPConfig) (string, func()) {
+	c.Bind = "localhost:0"
+	s, stats, err := chasm.NewServer(chasm.Config{HTTPConfig: &c})
+	if err != nil {
+		t.Fatalf("expected no error, got: %s", err.Error())
+	}
+	s.Serve()
+	go func() {
+		for range stats {
+			// Nothing, just consume the channel.
+		}
+	}()
+	return s.HTTPURL, s.Close
+}
+
+func TestHTTPWriter_TLS(t *testing.T) {
+	dir, err := ioutil.TempDir("", "avalanche-tls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	certs := writeTestCerts(t, dir)
+
+	url, closeServer := startTLSChasm(t, chasm.HTTPConfig{
+		TLSCertFile: certs.serverCertFile,
+		TLSKeyFile:  certs.serverKeyFile,
+	})
+	defer closeServer()
+
+	for _, tt := range []struct {
+		name   string
+		c      avalanche.HTTPWriterConfig
+		expErr bool
+	}{
+		{"unknown CA", avalanche.HTTPWriterConfig{}, true},
+		{"CA file", avalanche.HTTPWriterConfig{TLSCAFile: certs.caFile}, false},
+		{"insecure skip verify", avalanche.HTTPWriterConfig{InsecureSkipVerify: true}, false},
+		{"missing CA file", avalanche.HTTPWriterConfig{TLSCAFile: filepath.Join(dir, "missing.pem")}, true},
+		{"CA file without certificates", avalanche.HTTPWriterConfig{TLSCAFile: certs.serverKeyFile}, true},
+	} {
+		tt.c.Host = url
+		tt.c.Database = "mydb"
+		_, err := avalanche.NewHTTPWriter(tt.c).WriteLineProtocol([]byte("cpu usage=99"))
+		if tt.expErr && err == nil {
+			t.Errorf("%s: expected error, got nil", tt.name)
+		} else if !tt.expErr && err != nil {
+			t.Errorf("%s: expected no error, got: %s", tt.name, err.Error())
+		}
+	}
+}
+
+func TestHTTPWriter_MutualTLS(t *testing.T) {
+	dir, err := ioutil.TempDir("", "avalanche-tls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	certs := writeTestCerts(t, dir)
+
+	url, closeServer := startTLSChasm(t, chasm.HTTPConfig{
+		TLSCertFile:     certs.serverCertFile,
+		TLSKeyFile:      certs.serverKeyFile,
+		TLSClientCAFile: certs.caFile,
+	})
+	defer closeServer()
+
+	for _, tt := range []struct {
+		name   string
+		c      avalanche.HTTPWriterConfig
+		expErr bool
+	}{
+		{"no client certificate", avalanche.HTTPWriterConfig{}, true},
+		{"client certificate", avalanche.HTTPWriterConfig{TLSCertFile: certs.clientCertFile, TLSKeyFile: certs.clientKeyFile}, false},
+		{"missing client key", avalanche.HTTPWriterConfig{TLSCertFile: certs.clientCertFile}, true},
+	} {
+		tt.c.Host = url
+		tt.c.Database = "mydb"
+		tt.c.TLSCAFile = certs.caFile
+		_, err := avalanche.NewHTTPWriter(tt.c).WriteLineProtocol([]byte("cpu usage=99"))
+		if tt.expErr && err == nil {
+			t.Errorf("%s: expected error, got nil", tt.name)
+		} else if !tt.expErr && err != nil {
+			t.Errorf("%s: expected no error, got: %s", tt.name, err.Error())
+		}
+	}
+}
@@ -0,0 +1,128 @@
+package avalanche
+
+import (
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/mark-rushakoff/mountainflux/canyon"
+)
+
+// DefaultUDPPayloadSize is the default maximum payload size of a single datagram:
+// a 1500-byte Ethernet MTU minus the IPv4 and UDP headers.
+const DefaultUDPPayloadSize = 1472
+
+// UDPWriterConfig is the configuration used to create a UDPWriter.
+type UDPWriterConfig struct {
+	// Address of the target UDP listener, in form "example.com:8089"
+	Addr string
+
+	// Maximum size in bytes of a single datagram's payload.
+	// Defaults to DefaultUDPPayloadSize.
+	PayloadSize int
+}
+
+// UDPWriter is a Writer that writes to an InfluxDB UDP listener.
+type UDPWriter struct {
+	conn net.Conn
+
+	c UDPWriterConfig
+}
+
+var _ LineProtocolWriter = (*UDPWriter)(nil)
+
+// NewUDPWriter returns a new UDPWriter from the supplied UDPWriterConfig.
+// It returns an error if the address can't be resolved.
+func NewUDPWriter(c UDPWriterConfig) (*UDPWriter, error) {
+	if c.PayloadSize <= 0 {
+		c.PayloadSize = DefaultUDPPayloadSize
+	}
+
+	conn, err := net.Dial("udp", c.Addr)
+	if err != nil {
+		return nil, err
+	}
+
+	return &UDPWriter{
+		conn: conn,
+		c:    c,
+	}, nil
+}
+
+// WriteLineProtocol writes the given byte slice to the UDP listener described in the Writer's UDPWriterConfig.
+// The body is split into as few datagrams as possible without exceeding the configured payload size
+// and without splitting any line across datagrams, including at newlines in quoted string field values.
+//
+// It returns the latency in nanoseconds of sending all the datagrams and the first error received while sending.
+// UDP gives no indication of whether the server accepted the data, so no error does not guarantee delivery.
+// Any line too large to fit in a datagram is skipped, and reported in a returned *OversizeError after the rest are sent.
+func (w *UDPWriter) WriteLineProtocol(body []byte) (int64, error) {
+	var skipped int
+	start := time.Now()
+	for len(body) > 0 {
+		n := w.nextPayloadSize(body)
+		if n == 0 {
+			// The first line is too large to send, so drop it.
+			skipped++
+			if i := canyon.LineEnd(body); i >= 0 {
+				body = body[i+1:]
+			} else {
+				body = nil
+			}
+			continue
+		}
+
+		if _, err := w.conn.Write(body[:n]); err != nil {
+			return time.Since(start).Nanoseconds(), err
+		}
+		body = body[n:]
+	}
+	lat := time.Since(start).Nanoseconds()
+
+	if skipped > 0 {
+		return lat, &OversizeError{Skipped: skipped, PayloadSize: w.c.PayloadSize}
+	}
+	return lat, nil
+}
+
+// OversizeError is returned by UDPWriter when lines too large to fit in a datagram were skipped.
+// The rest of the lines were sent, so the write must not be retried.
+type OversizeError struct {
+	// Number of lines skipped.
+	Skipped int
+
+	// Maximum payload size in bytes of each datagram.
+	PayloadSize int
+}
+
+func (e *OversizeError) Error() string {
+	return fmt.Sprintf("skipped %d line(s) larger than max payload size of %d bytes", e.Skipped, e.PayloadSize)
+}
+
+// Temporary always returns false: retrying would send the other lines again.
+func (e *OversizeError) Temporary() bool {
+	return false
+}
+
+// nextPayloadSize returns the number of bytes at the start of body to send in the next datagram:
+// as many whole lines as fit in the payload size,
+// or 0 if the first line alone is too large.
+func (w *UDPWriter) nextPayloadSize(body []byte) int {
+	if len(body) <= w.c.PayloadSize {
+		return len(body)
+	}
+
+	n := 0
+	for {
+		i := canyon.LineEnd(body[n:])
+		if i < 0 || n+i+1 > w.c.PayloadSize {
+			return n
+		}
+		n += i + 1
+	}
+}
+
+// Close closes the underlying connection.
+func (w *UDPWriter) Close() error {
+	return w.conn.Close()
+}
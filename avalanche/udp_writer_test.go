@@ -0,0 +1,172 @@
+package avalanche_test
+
+import (
+	"bytes"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mark-rushakoff/mountainflux/avalanche"
+)
+
+// readDatagrams reads from pc until no datagram arrives for a short while.
+func readDatagrams(t *testing.T, pc net.PacketConn) []string {
+	var datagrams []string
+	buf := make([]byte, 64*1024)
+	for {
+		pc.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+		n, _, err := pc.ReadFrom(buf)
+		if err != nil {
+			if ne, ok := err.(net.Error); ok && ne.Timeout() {
+				return datagrams
+			}
+			t.Fatalf("exp no error, got: %s", err.Error())
+		}
+		datagrams = append(datagrams, string(buf[:n]))
+	}
+}
+
+func TestUDPWriter_Write(t *testing.T) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("exp no error, got: %s", err.Error())
+	}
+	defer pc.Close()
+
+	const payloadSize = 64
+	w, err := avalanche.NewUDPWriter(avalanche.UDPWriterConfig{
+		Addr:        pc.LocalAddr().String(),
+		PayloadSize: payloadSize,
+	})
+	if err != nil {
+		t.Fatalf("exp no error, got: %s", err.Error())
+	}
+	defer w.Close()
+
+	// 21 bytes per line, so 3 lines per datagram.
+	body := bytes.Repeat([]byte("cpu,host=h1 usage=99\n"), 10)
+	lat, err := w.WriteLineProtocol(body)
+	if err != nil {
+		t.Fatalf("exp no error, got: %s", err.Error())
+	}
+	if lat <= 0 {
+		t.Fatalf("exp positive latency, got: %d", lat)
+	}
+
+	datagrams := readDatagrams(t, pc)
+	if len(datagrams) != 4 {
+		t.Fatalf("exp 4 datagrams, got %d: %q", len(datagrams), datagrams)
+	}
+	for _, d := range datagrams {
+		if len(d) > payloadSize {
+			t.Errorf("exp datagram size <= %d, got %d: %q", payloadSize, len(d), d)
+		}
+		if !strings.HasSuffix(d, "\n") {
+			t.Errorf("exp datagram to end with a whole line, got: %q", d)
+		}
+	}
+	if got := strings.Join(datagrams, ""); got != string(body) {
+		t.Fatalf("got: %q, exp: %q", got, body)
+	}
+}
+
+func TestUDPWriter_SkipsOversizeLines(t *testing.T) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("exp no error, got: %s", err.Error())
+	}
+	defer pc.Close()
+
+	w, err := avalanche.NewUDPWriter(avalanche.UDPWriterConfig{
+		Addr:        pc.LocalAddr().String(),
+		PayloadSize: 32,
+	})
+	if err != nil {
+		t.Fatalf("exp no error, got: %s", err.Error())
+	}
+	defer w.Close()
+
+	big := "cpu,host=h1 " + strings.Repeat("x", 32) + "=1\n"
+	body := "cpu f=1\n" + big + "cpu f=2"
+	if _, err := w.WriteLineProtocol([]byte(body)); err == nil {
+		t.Fatalf("exp error for oversize line, got nil")
+	}
+
+	if got := strings.Join(readDatagrams(t, pc), ""); got != "cpu f=1\ncpu f=2" {
+		t.Fatalf("got: %q, exp: %q", got, "cpu f=1\ncpu f=2")
+	}
+}
+
+func TestUDPWriter_MultilineStrings(t *testing.T) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("exp no error, got: %s", err.Error())
+	}
+	defer pc.Close()
+
+	w, err := avalanche.NewUDPWriter(avalanche.UDPWriterConfig{
+		Addr:        pc.LocalAddr().String(),
+		PayloadSize: 32,
+	})
+	if err != nil {
+		t.Fatalf("exp no error, got: %s", err.Error())
+	}
+	defer w.Close()
+
+	// The newline in the string fits in the first datagram, but the rest of its line doesn't.
+	multi := "m s=\"a\n" + strings.Repeat("b", 20) + "\"\n"
+	// This one doesn't fit in a datagram at all.
+	big := "m s=\"a\n" + strings.Repeat("z", 32) + "\"\n"
+	_, err = w.WriteLineProtocol([]byte("cpu f=1\n" + multi + big + "cpu f=2"))
+	oe, ok := err.(*avalanche.OversizeError)
+	if !ok {
+		t.Fatalf("exp *OversizeError, got: %v", err)
+	}
+	if oe.Skipped != 1 {
+		t.Fatalf("exp 1 skipped line, got: %d", oe.Skipped)
+	}
+
+	exp := []string{"cpu f=1\n", multi, "cpu f=2"}
+	if got := readDatagrams(t, pc); !reflect.DeepEqual(got, exp) {
+		t.Fatalf("got: %q, exp: %q", got, exp)
+	}
+}
+
+func TestUDPWriter_OversizeLinesNotRetried(t *testing.T) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("exp no error, got: %s", err.Error())
+	}
+	defer pc.Close()
+
+	uw, err := avalanche.NewUDPWriter(avalanche.UDPWriterConfig{
+		Addr:        pc.LocalAddr().String(),
+		PayloadSize: 32,
+	})
+	if err != nil {
+		t.Fatalf("exp no error, got: %s", err.Error())
+	}
+	defer uw.Close()
+
+	w := avalanche.NewRetryWriter(uw, avalanche.RetryConfig{
+		MaxAttempts:    3,
+		InitialBackoff: time.Millisecond,
+	})
+
+	big := "cpu,host=h1 " + strings.Repeat("x", 32) + "=1\n"
+	_, err = w.WriteLineProtocol([]byte("cpu f=1\n" + big + "cpu f=2"))
+	oe, ok := err.(*avalanche.OversizeError)
+	if !ok {
+		t.Fatalf("exp *OversizeError, got: %v", err)
+	}
+	if oe.Skipped != 1 {
+		t.Fatalf("exp 1 skipped line, got: %d", oe.Skipped)
+	}
+
+	// The lines that fit must only be sent once.
+	if got := strings.Join(readDatagrams(t, pc), ""); got != "cpu f=1\ncpu f=2" {
+		t.Fatalf("got: %q, exp: %q", got, "cpu f=1\ncpu f=2")
+	}
+}
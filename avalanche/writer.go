@@ -1,5 +1,7 @@
 package avalanche
 
+import "context"
+
 // LineProtocolWriter is the interface used to write InfluxDB Line Protocol to a remote server.
 type LineProtocolWriter interface {
 	// WriteLineProtocol writes the given byte slice containing line protocol data
@@ -9,3 +11,33 @@ type LineProtocolWriter interface {
 	// other, context-specific errors.
 	WriteLineProtocol([]byte) (latencyNs int64, err error)
 }
+
+// ContextLineProtocolWriter is like LineProtocolWriter, but each write accepts a context,
+// so that writes can be canceled or bounded by a deadline.
+type ContextLineProtocolWriter interface {
+	// WriteLineProtocolContext is like WriteLineProtocol,
+	// but returns ctx.Err() if ctx is done before the write completes.
+	WriteLineProtocolContext(ctx context.Context, body []byte) (latencyNs int64, err error)
+}
+
+// WithContext returns w as a ContextLineProtocolWriter.
+// If w already implements ContextLineProtocolWriter, it is returned as-is.
+// Otherwise, w is adapted so that ctx is checked before each write;
+// an adapted write that has already started runs to completion regardless of ctx.
+func WithContext(w LineProtocolWriter) ContextLineProtocolWriter {
+	if cw, ok := w.(ContextLineProtocolWriter); ok {
+		return cw
+	}
+	return contextAdapter{w: w}
+}
+
+type contextAdapter struct {
+	w LineProtocolWriter
+}
+
+func (a contextAdapter) WriteLineProtocolContext(ctx context.Context, body []byte) (int64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	return a.w.WriteLineProtocol(body)
+}
@@ -0,0 +1,52 @@
+package avalanche_test
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/mark-rushakoff/mountainflux/avalanche"
+)
+
+func TestWithContext(t *testing.T) {
+	sw := &scriptedWriter{}
+	w := avalanche.WithContext(sw)
+
+	if _, err := w.WriteLineProtocolContext(context.Background(), []byte("cpu usage=99")); err != nil {
+		t.Fatalf("expected no error, got: %s", err.Error())
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := w.WriteLineProtocolContext(ctx, []byte("cpu usage=99")); err != context.Canceled {
+		t.Fatalf("expected context.Canceled, got: %v", err)
+	}
+
+	if sw.writes != 1 {
+		t.Fatalf("expected 1 write, got: %d", sw.writes)
+	}
+
+	// Writers that already accept a context are returned as-is.
+	rw := avalanche.NewRetryWriter(sw, avalanche.RetryConfig{})
+	if cw := avalanche.WithContext(rw); cw != avalanche.ContextLineProtocolWriter(rw) {
+		t.Fatalf("expected RetryWriter to be returned as-is")
+	}
+}
+
+func TestRetryWriter_ContextCancelsBackoff(t *testing.T) {
+	sw := &scriptedWriter{errs: []error{
+		&avalanche.WriteError{StatusCode: http.StatusServiceUnavailable},
+		&avalanche.WriteError{StatusCode: http.StatusServiceUnavailable},
+	}}
+	w := avalanche.NewRetryWriter(sw, avalanche.RetryConfig{InitialBackoff: time.Hour})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := w.WriteLineProtocolContext(ctx, []byte("cpu usage=99")); err != context.DeadlineExceeded {
+		t.Fatalf("expected context.DeadlineExceeded, got: %v", err)
+	}
+	if sw.writes != 1 {
+		t.Fatalf("expected 1 write, got: %d", sw.writes)
+	}
+}
@@ -9,6 +9,16 @@ import (
 )
 
 func benchmarkHTTPSmallPoints(numLines int, b *testing.B) {
+	benchmarkHTTPSmallPointsConfig(numLines, avalanche.HTTPWriterConfig{Database: "d"}, b)
+}
+
+func benchmarkHTTPSmallPointsGzip(numLines int, b *testing.B) {
+	benchmarkHTTPSmallPointsConfig(numLines, avalanche.HTTPWriterConfig{Database: "d", Gzip: true}, b)
+}
+
+// benchmarkHTTPSmallPointsConfig writes numLines small points per request to a chasm server,
+// using an HTTPWriter configured by c with the Host filled in.
+func benchmarkHTTPSmallPointsConfig(numLines int, c avalanche.HTTPWriterConfig, b *testing.B) {
 	s, serverStats, err := chasm.NewServer(chasm.Config{
 		HTTPConfig: &chasm.HTTPConfig{
 			Bind: "localhost:0",
@@ -26,12 +36,11 @@ func benchmarkHTTPSmallPoints(numLines int, b *testing.B) {
 	defer s.Close()
 
 	lines := bytes.Repeat([]byte("cpu,host=h1 usage=99\n"), numLines)
-	w := avalanche.NewHTTPWriter(avalanche.HTTPWriterConfig{
-		Host:     s.HTTPURL,
-		Database: "d",
-	})
+	c.Host = s.HTTPURL
+	w := avalanche.NewHTTPWriter(c)
 
 	var expBytes uint64
+	b.ReportAllocs()
 	b.ResetTimer()
 
 	for i := 0; i < b.N; i++ {
@@ -60,3 +69,21 @@ func BenchmarkHTTPSmallPoints8192(b *testing.B)  { benchmarkHTTPSmallPoints(8192
 func BenchmarkHTTPSmallPoints16384(b *testing.B) { benchmarkHTTPSmallPoints(16384, b) }
 func BenchmarkHTTPSmallPoints32768(b *testing.B) { benchmarkHTTPSmallPoints(32768, b) }
 func BenchmarkHTTPSmallPoints65536(b *testing.B) { benchmarkHTTPSmallPoints(65536, b) }
+
+func BenchmarkHTTPSmallPointsGzip1(b *testing.B)     { benchmarkHTTPSmallPointsGzip(1, b) }
+func BenchmarkHTTPSmallPointsGzip2(b *testing.B)     { benchmarkHTTPSmallPointsGzip(2, b) }
+func BenchmarkHTTPSmallPointsGzip4(b *testing.B)     { benchmarkHTTPSmallPointsGzip(4, b) }
+func BenchmarkHTTPSmallPointsGzip8(b *testing.B)     { benchmarkHTTPSmallPointsGzip(8, b) }
+func BenchmarkHTTPSmallPointsGzip16(b *testing.B)    { benchmarkHTTPSmallPointsGzip(16, b) }
+func BenchmarkHTTPSmallPointsGzip32(b *testing.B)    { benchmarkHTTPSmallPointsGzip(32, b) }
+func BenchmarkHTTPSmallPointsGzip64(b *testing.B)    { benchmarkHTTPSmallPointsGzip(64, b) }
+func BenchmarkHTTPSmallPointsGzip128(b *testing.B)   { benchmarkHTTPSmallPointsGzip(128, b) }
+func BenchmarkHTTPSmallPointsGzip256(b *testing.B)   { benchmarkHTTPSmallPointsGzip(256, b) }
+func BenchmarkHTTPSmallPointsGzip512(b *testing.B)   { benchmarkHTTPSmallPointsGzip(512, b) }
+func BenchmarkHTTPSmallPointsGzip1024(b *testing.B)  { benchmarkHTTPSmallPointsGzip(1024, b) }
+func BenchmarkHTTPSmallPointsGzip2048(b *testing.B)  { benchmarkHTTPSmallPointsGzip(2048, b) }
+func BenchmarkHTTPSmallPointsGzip4096(b *testing.B)  { benchmarkHTTPSmallPointsGzip(4096, b) }
+func BenchmarkHTTPSmallPointsGzip8192(b *testing.B)  { benchmarkHTTPSmallPointsGzip(8192, b) }
+func BenchmarkHTTPSmallPointsGzip16384(b *testing.B) { benchmarkHTTPSmallPointsGzip(16384, b) }
+func BenchmarkHTTPSmallPointsGzip32768(b *testing.B) { benchmarkHTTPSmallPointsGzip(32768, b) }
+func BenchmarkHTTPSmallPointsGzip65536(b *testing.B) { benchmarkHTTPSmallPointsGzip(65536, b) }
@@ -0,0 +1,125 @@
+package canyon
+
+import "bytes"
+
+// ScanLines is a bufio.SplitFunc that splits line protocol into lines without parsing them.
+// It behaves like bufio.ScanLines, except that newlines in quoted string field values don't end a line,
+// so a line is never split partway through a string.
+func ScanLines(data []byte, atEOF bool) (advance int, token []byte, err error) {
+	if atEOF && len(data) == 0 {
+		return 0, nil, nil
+	}
+
+	if i := LineEnd(data); i >= 0 {
+		return i + 1, dropCR(data[:i]), nil
+	}
+
+	// If we're at EOF, we have a final, non-terminated line. Return it.
+	if atEOF {
+		return len(data), dropCR(data), nil
+	}
+
+	// Request more data.
+	return 0, nil, nil
+}
+
+// CountLines returns the number of lines of line protocol in b that a Scanner would scan, without parsing them.
+// Like Scanner, it skips blank lines and comment lines,
+// and newlines in quoted string field values don't end a line.
+// The final line is counted even if it is missing its trailing newline.
+func CountLines(b []byte) int {
+	n := 0
+	for len(b) > 0 {
+		line := b
+		if i := LineEnd(b); i >= 0 {
+			line, b = b[:i], b[i+1:]
+		} else {
+			b = nil
+		}
+
+		line = bytes.TrimLeft(line, " \t\r")
+		if len(line) > 0 && line[0] != '#' {
+			n++
+		}
+	}
+	return n
+}
+
+// LineEnd returns the index of the newline that ends the line of line protocol at the start of b,
+// or -1 if the line isn't terminated.
+// Like ScanLines, it doesn't treat newlines in quoted string field values as line ends.
+func LineEnd(b []byte) int {
+	nl := bytes.IndexByte(b, '\n')
+	if nl < 0 {
+		return -1
+	}
+	if bytes.IndexByte(b[:nl], '"') < 0 {
+		// Only a quote can start a string that continues past the newline.
+		return nl
+	}
+
+	i := skipSpaces(b, 0)
+	if i < len(b) && b[i] == '#' {
+		// Quotes mean nothing in a comment.
+		return nl
+	}
+
+	// Measurement and tags, up to the first unescaped space.
+	for ; i < len(b) && b[i] != ' '; i++ {
+		switch b[i] {
+		case '\\':
+			i = skipEscaped(b, i)
+		case '\n':
+			return i
+		}
+	}
+
+	// Fields and timestamp, where a quote right after an unescaped equals sign starts a string.
+	for ; i < len(b); i++ {
+		switch b[i] {
+		case '\\':
+			i = skipEscaped(b, i)
+		case '\n':
+			return i
+		case '=':
+			if i+1 < len(b) && b[i+1] == '"' {
+				i = stringEnd(b, i+2)
+				if i < 0 {
+					return -1
+				}
+			}
+		}
+	}
+	return -1
+}
+
+// skipEscaped returns the index of the character escaped by the backslash at b[i].
+// A backslash never escapes a newline.
+func skipEscaped(b []byte, i int) int {
+	if i+1 < len(b) && b[i+1] != '\n' {
+		return i + 1
+	}
+	return i
+}
+
+// stringEnd returns the index of the unescaped quote ending the string value starting at b[i],
+// or -1 if the string isn't terminated.
+func stringEnd(b []byte, i int) int {
+	for ; i < len(b); i++ {
+		switch b[i] {
+		case '\\':
+			i++
+		case '"':
+			return i
+		}
+	}
+	return -1
+}
+
+// dropCR drops a terminal \r from the data.
+func dropCR(data []byte) []byte {
+	if len(data) > 0 && data[len(data)-1] == '\r' {
+		return data[:len(data)-1]
+	}
+	return data
+}
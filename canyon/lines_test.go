@@ -0,0 +1,77 @@
+package canyon_test
+
+import (
+	"bufio"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/mark-rushakoff/mountainflux/canyon"
+)
+
+var scanLinesTests = []struct {
+	in  string
+	exp []string
+}{
+	{"m f=1\nm f=2\n", []string{"m f=1", "m f=2"}},
+	{"m f=1\r\nm f=2", []string{"m f=1", "m f=2"}},
+	{"m f=\"a\nb\" 1\nm f=2\n", []string{"m f=\"a\nb\" 1", "m f=2"}},
+	{"m f=\"a\\\"\nb\",g=\"\n\"\nm f=2\n", []string{"m f=\"a\\\"\nb\",g=\"\n\"", "m f=2"}},
+	{"m\\ \"x,t=\"v f=1\nm f=2\n", []string{"m\\ \"x,t=\"v f=1", "m f=2"}},
+	{"m f\\=\"x=1\nm f=2\n", []string{"m f\\=\"x=1", "m f=2"}},
+	{"# f=\"comment\nm f=2\n", []string{"# f=\"comment", "m f=2"}},
+	{"m f=\"unterminated\nm f=2\n", []string{"m f=\"unterminated\nm f=2\n"}},
+	{"\nm f=1\n\n", []string{"", "m f=1", ""}},
+}
+
+func TestScanLines(t *testing.T) {
+	for _, st := range scanLinesTests {
+		s := bufio.NewScanner(strings.NewReader(st.in))
+		s.Split(canyon.ScanLines)
+
+		var got []string
+		for s.Scan() {
+			got = append(got, s.Text())
+		}
+		if err := s.Err(); err != nil {
+			t.Fatalf("%q: exp no error, got: %s", st.in, err.Error())
+		}
+		if !reflect.DeepEqual(got, st.exp) {
+			t.Errorf("%q: got: %q, exp: %q", st.in, got, st.exp)
+		}
+	}
+}
+
+var countLinesTests = []struct {
+	in  string
+	exp int
+}{
+	{"", 0},
+	{"m f=1", 1},
+	{"m f=1\n", 1},
+	{"m f=1 1\nm f=2\nm f=3 3\n", 3},
+	{"\n# comment\n  \r\nm f=1 1\n\nm f=2", 2},
+	{"m f=\"a\nb\" 1\nm f=\"\\\"\n\"\n", 2},
+	{"# f=\"comment\nm f=2\n", 1},
+}
+
+func TestCountLines(t *testing.T) {
+	for _, ct := range countLinesTests {
+		if got := canyon.CountLines([]byte(ct.in)); got != ct.exp {
+			t.Errorf("%q: exp %d lines, got: %d", ct.in, ct.exp, got)
+		}
+
+		// Every counted line must also be scanned.
+		s := canyon.NewScanner([]byte(ct.in))
+		n := 0
+		for s.Scan() {
+			n++
+		}
+		if err := s.Err(); err != nil {
+			t.Fatalf("%q: exp no error, got: %s", ct.in, err.Error())
+		}
+		if n != ct.exp {
+			t.Errorf("%q: exp Scanner to scan %d lines, got: %d", ct.in, ct.exp, n)
+		}
+	}
+}
@@ -0,0 +1,482 @@
+// Package canyon scans line protocol back into the measurements, tags, fields, and timestamps that river wrote.
+package canyon
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/mark-rushakoff/mountainflux/river"
+)
+
+// FieldType identifies which value of a Field is set.
+type FieldType int
+
+const (
+	FloatField FieldType = iota + 1
+	IntField
+	UintField
+	StringField
+	BoolField
+)
+
+func (t FieldType) String() string {
+	switch t {
+	case FloatField:
+		return "float"
+	case IntField:
+		return "int"
+	case UintField:
+		return "uint"
+	case StringField:
+		return "string"
+	case BoolField:
+		return "bool"
+	}
+
+	return fmt.Sprintf("FieldType(%d)", int(t))
+}
+
+// Field is a single scanned field.
+// Only the value matching Type is set.
+type Field struct {
+	Key  []byte
+	Type FieldType
+
+	FloatValue  float64
+	IntValue    int64
+	UintValue   uint64
+	StringValue []byte
+	BoolValue   bool
+}
+
+// Line is a single scanned line of line protocol.
+// All byte slices are unescaped.
+type Line struct {
+	Measurement []byte
+
+	// Tags in the order they appeared in the line.
+	Tags []river.Tag
+
+	// Fields in the order they appeared in the line.
+	Fields []Field
+
+	// Unix time in nanoseconds. Only valid if HasTime is true.
+	Time    int64
+	HasTime bool
+}
+
+// Point returns a copy of l as a river.Point, with typed river fields.
+// Unlike l, the returned Point remains valid after the next call to Scan.
+func (l *Line) Point() river.Point {
+	p := river.Point{
+		Measurement: clone(l.Measurement),
+		Tags:        make([]river.Tag, len(l.Tags)),
+		Fields:      make([]river.Field, len(l.Fields)),
+		Time:        l.Time,
+		HasTime:     l.HasTime,
+	}
+
+	for i, t := range l.Tags {
+		p.Tags[i] = river.Tag{Key: clone(t.Key), Value: clone(t.Value)}
+	}
+
+	for i, f := range l.Fields {
+		name := clone(f.Key)
+		switch f.Type {
+		case FloatField:
+			p.Fields[i] = river.Float{Name: name, Value: f.FloatValue}
+		case IntField:
+			p.Fields[i] = river.Int{Name: name, Value: f.IntValue}
+		case UintField:
+			p.Fields[i] = river.Uint{Name: name, Value: f.UintValue}
+		case StringField:
+			p.Fields[i] = river.String{Name: name, Value: clone(f.StringValue)}
+		case BoolField:
+			p.Fields[i] = river.Bool{Name: name, Value: f.BoolValue}
+		}
+	}
+
+	return p
+}
+
+func clone(b []byte) []byte {
+	return append([]byte{}, b...)
+}
+
+// ParseError describes a malformed line.
+type ParseError struct {
+	// 1-based number of the line in the input.
+	Line int
+
+	Msg string
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("line %d: %s", e.Line, e.Msg)
+}
+
+// Characters that are unescaped in each part of a line.
+// These match what river escapes.
+const (
+	measurementEscapes = ", "
+	tagEscapes         = ",= "
+	fieldKeyEscapes    = ",= "
+	stringValueEscapes = `"\`
+)
+
+// Scanner reads lines of line protocol from a byte slice, in the style of bufio.Scanner.
+// Blank lines and comment lines starting with # are skipped.
+//
+// Scanning does not allocate once the Scanner's internal buffers have grown to fit the largest line.
+// Consequently, the Line returned by Line, and every byte slice in it,
+// is only valid until the next call to Scan.
+type Scanner struct {
+	// Precision of the timestamps in the input.
+	// Scanned times are always converted to nanoseconds.
+	Precision river.Precision
+
+	buf     []byte
+	lineNum int
+
+	line    Line
+	scratch []byte
+
+	err error
+}
+
+// NewScanner returns a Scanner reading from b.
+func NewScanner(b []byte) *Scanner {
+	return &Scanner{buf: b}
+}
+
+// Scan advances the Scanner to the next line, which is then available through Line.
+// It returns false when the input is exhausted or a malformed line is encountered;
+// Err distinguishes the two.
+func (s *Scanner) Scan() bool {
+	if s.err != nil {
+		return false
+	}
+
+	for {
+		s.skipBlankLines()
+		if len(s.buf) == 0 {
+			return false
+		}
+
+		s.lineNum++
+		if s.buf[0] != '#' {
+			break
+		}
+
+		// Skip the comment line.
+		if i := bytes.IndexByte(s.buf, '\n'); i >= 0 {
+			s.buf = s.buf[i+1:]
+		} else {
+			s.buf = nil
+		}
+	}
+
+	n, err := s.parseLine(s.buf)
+	if err != nil {
+		s.err = &ParseError{Line: s.lineNum, Msg: err.Error()}
+		return false
+	}
+
+	s.unescape(n)
+	s.buf = s.buf[n:]
+	return true
+}
+
+// Line returns the most recently scanned line.
+func (s *Scanner) Line() *Line {
+	return &s.line
+}
+
+// Err returns the first error encountered while scanning, or nil if the input was exhausted without error.
+func (s *Scanner) Err() error {
+	return s.err
+}
+
+func (s *Scanner) skipBlankLines() {
+	for len(s.buf) > 0 {
+		switch s.buf[0] {
+		case '\n':
+			s.lineNum++
+			fallthrough
+		case ' ', '\t', '\r':
+			s.buf = s.buf[1:]
+		default:
+			return
+		}
+	}
+}
+
+// parseLine parses the line at the start of b into s.line,
+// returning the number of bytes consumed including the trailing newline, if any.
+// Parsed slices still point into b and still contain escape sequences.
+func (s *Scanner) parseLine(b []byte) (int, error) {
+	l := &s.line
+	l.Tags = l.Tags[:0]
+	l.Fields = l.Fields[:0]
+	l.HasTime = false
+	l.Time = 0
+
+	i := scanKey(b, 0, measurementEscapes)
+	if i == 0 {
+		return 0, fmt.Errorf("missing measurement")
+	}
+	l.Measurement = b[:i]
+
+	// Tags
+	for i < len(b) && b[i] == ',' {
+		start := i + 1
+		eq := scanKey(b, start, tagEscapes)
+		if eq >= len(b) || b[eq] != '=' {
+			return 0, fmt.Errorf("missing tag value")
+		}
+		if eq == start {
+			return 0, fmt.Errorf("missing tag key")
+		}
+
+		end := scanKey(b, eq+1, tagEscapes)
+		if end < len(b) && b[end] == '=' {
+			return 0, fmt.Errorf("unescaped = in tag value")
+		}
+		if end == eq+1 {
+			return 0, fmt.Errorf("missing tag value")
+		}
+
+		l.Tags = append(l.Tags, river.Tag{Key: b[start:eq], Value: b[eq+1 : end]})
+		i = end
+	}
+
+	if i >= len(b) || b[i] != ' ' {
+		return 0, fmt.Errorf("missing fields")
+	}
+	i = skipSpaces(b, i)
+
+	// Fields
+	for {
+		start := i
+		eq := scanKey(b, start, fieldKeyEscapes)
+		if eq >= len(b) || b[eq] != '=' {
+			return 0, fmt.Errorf("missing field value")
+		}
+		if eq == start {
+			return 0, fmt.Errorf("missing field key")
+		}
+
+		l.Fields = append(l.Fields, Field{Key: b[start:eq]})
+		f := &l.Fields[len(l.Fields)-1]
+
+		var err error
+		i, err = parseFieldValue(b, eq+1, f)
+		if err != nil {
+			return 0, err
+		}
+
+		if i < len(b) && b[i] == ',' {
+			i++
+			continue
+		}
+		break
+	}
+
+	// Optional timestamp
+	i = skipSpaces(b, i)
+	end := i
+	for end < len(b) && b[end] != '\n' {
+		end++
+	}
+	if ts := bytes.TrimRight(b[i:end], " \t\r"); len(ts) > 0 {
+		t, err := strconv.ParseInt(string(ts), 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid timestamp %q", ts)
+		}
+		l.Time = s.Precision.Nanoseconds(t)
+		l.HasTime = true
+	}
+
+	if end < len(b) {
+		// Consume the newline.
+		end++
+	}
+	return end, nil
+}
+
+// parseFieldValue parses the field value starting at b[i] into f,
+// returning the index just past the value.
+func parseFieldValue(b []byte, i int, f *Field) (int, error) {
+	if i >= len(b) {
+		return i, fmt.Errorf("missing field value")
+	}
+
+	if b[i] == '"' {
+		// Strings may contain anything, including newlines, except an unescaped quote.
+		for j := i + 1; j < len(b); j++ {
+			switch b[j] {
+			case '\\':
+				j++
+			case '"':
+				f.Type = StringField
+				f.StringValue = b[i+1 : j]
+				return j + 1, nil
+			}
+		}
+		return i, fmt.Errorf("unterminated string field value")
+	}
+
+	end := i
+	for end < len(b) && b[end] != ',' && b[end] != ' ' && b[end] != '\r' && b[end] != '\n' {
+		end++
+	}
+	v := b[i:end]
+	if len(v) == 0 {
+		return i, fmt.Errorf("missing field value")
+	}
+
+	switch string(v) {
+	case "t", "T", "true", "True", "TRUE":
+		f.Type = BoolField
+		f.BoolValue = true
+		return end, nil
+	case "f", "F", "false", "False", "FALSE":
+		f.Type = BoolField
+		f.BoolValue = false
+		return end, nil
+	}
+
+	var err error
+	switch c := v[0]; {
+	case c != '-' && c != '+' && c != '.' && (c < '0' || c > '9'):
+		return i, fmt.Errorf("invalid field value %q", v)
+	case v[len(v)-1] == 'i':
+		f.Type = IntField
+		f.IntValue, err = strconv.ParseInt(string(v[:len(v)-1]), 10, 64)
+	case v[len(v)-1] == 'u':
+		f.Type = UintField
+		f.UintValue, err = strconv.ParseUint(string(v[:len(v)-1]), 10, 64)
+	default:
+		f.Type = FloatField
+		if isDecimal(v) {
+			f.FloatValue, err = strconv.ParseFloat(string(v), 64)
+		} else {
+			err = strconv.ErrSyntax
+		}
+	}
+	if err != nil {
+		return i, fmt.Errorf("invalid %s field value %q", f.Type, v)
+	}
+
+	return end, nil
+}
+
+// unescape replaces any escaped slices in s.line with unescaped copies in s.scratch.
+// lineLen bounds the total size of the unescaped slices,
+// so s.scratch is grown once up front and never reallocated underneath earlier slices.
+func (s *Scanner) unescape(lineLen int) {
+	if cap(s.scratch) < lineLen {
+		s.scratch = make([]byte, 0, lineLen)
+	}
+	s.scratch = s.scratch[:0]
+
+	l := &s.line
+	l.Measurement = s.unescapeSlice(l.Measurement, measurementEscapes)
+	for i := range l.Tags {
+		l.Tags[i].Key = s.unescapeSlice(l.Tags[i].Key, tagEscapes)
+		l.Tags[i].Value = s.unescapeSlice(l.Tags[i].Value, tagEscapes)
+	}
+	for i := range l.Fields {
+		f := &l.Fields[i]
+		f.Key = s.unescapeSlice(f.Key, fieldKeyEscapes)
+		if f.Type == StringField {
+			f.StringValue = s.unescapeSlice(f.StringValue, stringValueEscapes)
+		}
+	}
+}
+
+// unescapeSlice returns b if it has no backslashes;
+// otherwise it returns a copy of b in s.scratch with the escaped chars unescaped.
+func (s *Scanner) unescapeSlice(b []byte, chars string) []byte {
+	if bytes.IndexByte(b, '\\') < 0 {
+		return b
+	}
+
+	start := len(s.scratch)
+	for i := 0; i < len(b); i++ {
+		if b[i] == '\\' && i+1 < len(b) && strings.IndexByte(chars, b[i+1]) >= 0 {
+			i++
+		}
+		s.scratch = append(s.scratch, b[i])
+	}
+	return s.scratch[start:len(s.scratch):len(s.scratch)]
+}
+
+// scanKey returns the index of the first unescaped comma, equals sign, space, or newline at or after b[i],
+// or len(b) if there is none.
+// Escaped characters are those in chars preceded by a backslash.
+func scanKey(b []byte, i int, chars string) int {
+	for ; i < len(b); i++ {
+		switch b[i] {
+		case '\\':
+			if i+1 < len(b) && strings.IndexByte(chars, b[i+1]) >= 0 {
+				i++
+			}
+		case ',', '=', ' ', '\n':
+			if b[i] == '=' && chars == measurementEscapes {
+				// Equals signs are allowed unescaped in measurements.
+				continue
+			}
+			return i
+		}
+	}
+	return i
+}
+
+func skipSpaces(b []byte, i int) int {
+	for i < len(b) && b[i] == ' ' {
+		i++
+	}
+	return i
+}
+
+// isDecimal reports whether v is a decimal number with an optional fraction and exponent, such as -1, 1.5 or 1e-3.
+// strconv.ParseFloat also accepts infinities, NaN and hexadecimal floats, which line protocol doesn't allow.
+func isDecimal(v []byte) bool {
+	i := 0
+	if i < len(v) && (v[i] == '-' || v[i] == '+') {
+		i++
+	}
+
+	start := i
+	i = skipDigits(v, i)
+	if i < len(v) && v[i] == '.' {
+		i = skipDigits(v, i+1)
+	}
+	if i == start || (i == start+1 && v[start] == '.') {
+		// No digits in either the integer or fractional part.
+		return false
+	}
+
+	if i < len(v) && (v[i] == 'e' || v[i] == 'E') {
+		i++
+		if i < len(v) && (v[i] == '-' || v[i] == '+') {
+			i++
+		}
+		exp := i
+		if i = skipDigits(v, i); i == exp {
+			return false
+		}
+	}
+
+	return i == len(v)
+}
+
+func skipDigits(b []byte, i int) int {
+	for i < len(b) && b[i] >= '0' && b[i] <= '9' {
+		i++
+	}
+	return i
+}
@@ -0,0 +1,302 @@
+package canyon_test
+
+import (
+	"bytes"
+	"math"
+	"reflect"
+	"testing"
+
+	"github.com/mark-rushakoff/mountainflux/canyon"
+	"github.com/mark-rushakoff/mountainflux/river"
+)
+
+// roundTripTests are written with river and must scan back to the same values.
+var roundTripTests = []struct {
+	measurement string
+	tags        map[string]string
+	fields      []river.Field
+	exp         canyon.Line
+}{
+	{
+		measurement: "cpu",
+		tags:        map[string]string{"host": "h1", "region": "west"},
+		fields: []river.Field{
+			river.Bool{Name: []byte("idle"), Value: true},
+			river.Int{Name: []byte("procs"), Value: -3},
+			river.Uint{Name: []byte("ticks"), Value: math.MaxUint64},
+			river.Float{Name: []byte("usage"), Value: 99.5},
+			river.String{Name: []byte("state"), Value: []byte("ok")},
+		},
+		exp: canyon.Line{
+			Measurement: []byte("cpu"),
+			Tags: []river.Tag{
+				{Key: []byte("host"), Value: []byte("h1")},
+				{Key: []byte("region"), Value: []byte("west")},
+			},
+			Fields: []canyon.Field{
+				{Key: []byte("idle"), Type: canyon.BoolField, BoolValue: true},
+				{Key: []byte("procs"), Type: canyon.IntField, IntValue: -3},
+				{Key: []byte("ticks"), Type: canyon.UintField, UintValue: math.MaxUint64},
+				{Key: []byte("usage"), Type: canyon.FloatField, FloatValue: 99.5},
+				{Key: []byte("state"), Type: canyon.StringField, StringValue: []byte("ok")},
+			},
+		},
+	},
+
+	// No tags
+	{
+		measurement: "m",
+		fields:      []river.Field{river.Float{Name: []byte("f"), Value: -1e-9}},
+		exp: canyon.Line{
+			Measurement: []byte("m"),
+			Tags:        []river.Tag{},
+			Fields:      []canyon.Field{{Key: []byte("f"), Type: canyon.FloatField, FloatValue: -1e-9}},
+		},
+	},
+
+	// Everything that needs escaping
+	{
+		measurement: "cpu load,=",
+		tags:        map[string]string{"host name": "h,1=x"},
+		fields: []river.Field{
+			river.Int{Name: []byte("a b,c=d"), Value: 1},
+			river.String{Name: []byte("msg"), Value: []byte(`say "hi" \ bye, x=y` + "\nnext line")},
+		},
+		exp: canyon.Line{
+			Measurement: []byte("cpu load,="),
+			Tags:        []river.Tag{{Key: []byte("host name"), Value: []byte("h,1=x")}},
+			Fields: []canyon.Field{
+				{Key: []byte("a b,c=d"), Type: canyon.IntField, IntValue: 1},
+				{Key: []byte("msg"), Type: canyon.StringField, StringValue: []byte(`say "hi" \ bye, x=y` + "\nnext line")},
+			},
+		},
+	},
+
+	// Empty string
+	{
+		measurement: "m",
+		fields:      []river.Field{river.String{Name: []byte("s"), Value: []byte{}}},
+		exp: canyon.Line{
+			Measurement: []byte("m"),
+			Tags:        []river.Tag{},
+			Fields:      []canyon.Field{{Key: []byte("s"), Type: canyon.StringField, StringValue: []byte{}}},
+		},
+	},
+}
+
+func TestScanner_RoundTrip(t *testing.T) {
+	const ts = int64(1435362189575692182)
+
+	for _, p := range []river.Precision{river.Nanosecond, river.Microsecond, river.Millisecond, river.Second} {
+		var buf bytes.Buffer
+		for _, rt := range roundTripTests {
+			sk := river.SeriesKey(rt.measurement, rt.tags)
+			river.WriteLinePrecision(&buf, sk, rt.fields, ts, p)
+			river.WriteLineNoTime(&buf, sk, rt.fields)
+		}
+
+		s := canyon.NewScanner(buf.Bytes())
+		s.Precision = p
+		expTime := p.Nanoseconds(p.Convert(ts))
+		for i, rt := range roundTripTests {
+			// Once with a timestamp and once without.
+			for _, hasTime := range []bool{true, false} {
+				if !s.Scan() {
+					t.Fatalf("precision %s, test %d: exp line, got error: %v", p, i, s.Err())
+				}
+
+				exp := rt.exp
+				exp.HasTime = hasTime
+				if hasTime {
+					exp.Time = expTime
+				}
+				if got := s.Line(); !reflect.DeepEqual(*got, exp) {
+					t.Errorf("precision %s, test %d:\ngot: %+v\nexp: %+v", p, i, *got, exp)
+				}
+			}
+		}
+
+		if s.Scan() {
+			t.Fatalf("precision %s: exp no more lines, got: %+v", p, *s.Line())
+		}
+		if err := s.Err(); err != nil {
+			t.Fatalf("precision %s: exp no error, got: %s", p, err.Error())
+		}
+	}
+}
+
+func TestScanner_SkipsBlankAndCommentLines(t *testing.T) {
+	in := "\n# a comment\n  \r\nm f=1i 1\n\n# another\nm f=2i 2"
+	s := canyon.NewScanner([]byte(in))
+
+	var got []int64
+	for s.Scan() {
+		got = append(got, s.Line().Fields[0].IntValue)
+	}
+	if err := s.Err(); err != nil {
+		t.Fatalf("exp no error, got: %s", err.Error())
+	}
+	if !reflect.DeepEqual(got, []int64{1, 2}) {
+		t.Fatalf("got: %v, exp: [1 2]", got)
+	}
+}
+
+var fieldValueTests = []struct {
+	in  string
+	exp canyon.Field
+}{
+	{"m f=1\r\n", canyon.Field{Key: []byte("f"), Type: canyon.FloatField, FloatValue: 1}},
+	{"m f=-1.5 1\r\n", canyon.Field{Key: []byte("f"), Type: canyon.FloatField, FloatValue: -1.5}},
+	{"m f=.5\r\n", canyon.Field{Key: []byte("f"), Type: canyon.FloatField, FloatValue: .5}},
+	{"m f=5.", canyon.Field{Key: []byte("f"), Type: canyon.FloatField, FloatValue: 5}},
+	{"m f=+1E+3", canyon.Field{Key: []byte("f"), Type: canyon.FloatField, FloatValue: 1e3}},
+	{"m f=1e-3\r\n", canyon.Field{Key: []byte("f"), Type: canyon.FloatField, FloatValue: 1e-3}},
+	{"m f=3i\r\n", canyon.Field{Key: []byte("f"), Type: canyon.IntField, IntValue: 3}},
+	{"m f=3u\r\n", canyon.Field{Key: []byte("f"), Type: canyon.UintField, UintValue: 3}},
+	{"m f=true\r\n", canyon.Field{Key: []byte("f"), Type: canyon.BoolField, BoolValue: true}},
+}
+
+func TestScanner_FieldValues(t *testing.T) {
+	for _, ft := range fieldValueTests {
+		s := canyon.NewScanner([]byte(ft.in))
+		if !s.Scan() {
+			t.Errorf("%q: exp line, got error: %v", ft.in, s.Err())
+			continue
+		}
+		if got := s.Line().Fields; !reflect.DeepEqual(got, []canyon.Field{ft.exp}) {
+			t.Errorf("%q: got: %+v, exp: %+v", ft.in, got, ft.exp)
+		}
+		if s.Scan() {
+			t.Errorf("%q: exp no more lines, got: %+v", ft.in, *s.Line())
+		}
+	}
+}
+
+var parseErrorTests = []struct {
+	in      string
+	expLine int
+}{
+	{"m", 1},
+	{",t=v f=1", 1},
+	{"m,t f=1", 1},
+	{"m,=v f=1", 1},
+	{"m,t= f=1", 1},
+	{"m,t=a=b f=1", 1},
+	{"m f", 1},
+	{"m =1", 1},
+	{"m f=", 1},
+	{"m f=abc", 1},
+	{"m f=1.2.3", 1},
+	{"m f=12xi", 1},
+	{"m f=-1u", 1},
+	{`m f="unterminated`, 1},
+	{"m f=-inf", 1},
+	{"m f=+Inf", 1},
+	{"m f=NaN", 1},
+	{"m f=0x1p4", 1},
+	{"m f=-0x10", 1},
+	{"m f=1_000", 1},
+	{"m f=1e", 1},
+	{"m f=.", 1},
+	{"m f=-.e1", 1},
+	{"m f=1 notatime", 1},
+	{"m f=1 1\n\nm f=2 2\nm", 4},
+}
+
+func TestScanner_ParseErrors(t *testing.T) {
+	for _, pt := range parseErrorTests {
+		s := canyon.NewScanner([]byte(pt.in))
+		for s.Scan() {
+		}
+
+		err, ok := s.Err().(*canyon.ParseError)
+		if !ok {
+			t.Errorf("%q: exp *ParseError, got: %v", pt.in, s.Err())
+			continue
+		}
+		if err.Line != pt.expLine {
+			t.Errorf("%q: exp error on line %d, got: %s", pt.in, pt.expLine, err.Error())
+		}
+	}
+}
+
+func TestScanner_DoesNotAllocate(t *testing.T) {
+	in := bytes.Repeat([]byte(`cpu\ load,host=h\,1,region=west idle=T,procs=3i,ticks=4u,usage=99.5,state="\"ok\"" 1435362189575692182`+"\n"), 100)
+
+	s := canyon.NewScanner(in)
+	allocs := testing.AllocsPerRun(99, func() {
+		if !s.Scan() {
+			t.Fatalf("exp line, got error: %v", s.Err())
+		}
+	})
+	if allocs != 0 {
+		t.Fatalf("exp 0 allocations, got: %v", allocs)
+	}
+}
+
+func TestLine_Point(t *testing.T) {
+	in := `cpu\ load,host=h\,1,region=west idle=T,procs=3i,ticks=4u,usage=99.5,state="\"ok\"" 1435362189575692182` + "\n" +
+		"mem free=1i\n"
+
+	s := canyon.NewScanner([]byte(in))
+	var points []river.Point
+	for s.Scan() {
+		points = append(points, s.Line().Point())
+	}
+	if err := s.Err(); err != nil {
+		t.Fatalf("exp no error, got: %s", err.Error())
+	}
+
+	exp := []river.Point{
+		{
+			Measurement: []byte("cpu load"),
+			Tags: []river.Tag{
+				{Key: []byte("host"), Value: []byte("h,1")},
+				{Key: []byte("region"), Value: []byte("west")},
+			},
+			Fields: []river.Field{
+				river.Bool{Name: []byte("idle"), Value: true},
+				river.Int{Name: []byte("procs"), Value: 3},
+				river.Uint{Name: []byte("ticks"), Value: 4},
+				river.Float{Name: []byte("usage"), Value: 99.5},
+				river.String{Name: []byte("state"), Value: []byte(`"ok"`)},
+			},
+			Time:    1435362189575692182,
+			HasTime: true,
+		},
+		{
+			Measurement: []byte("mem"),
+			Tags:        []river.Tag{},
+			Fields:      []river.Field{river.Int{Name: []byte("free"), Value: 1}},
+		},
+	}
+	if !reflect.DeepEqual(points, exp) {
+		t.Fatalf("got: %+v\nexp: %+v", points, exp)
+	}
+
+	// Writing the points back out reproduces the input.
+	var out []byte
+	for i := range points {
+		out = river.AppendPoint(out, &points[i])
+	}
+	if string(out) != in {
+		t.Fatalf("got: %s, exp: %s", out, in)
+	}
+}
+
+func BenchmarkScanner(b *testing.B) {
+	line := []byte(`cpu,host=h1,region=west idle=T,procs=3i,ticks=4u,usage=99.5,state="ok" 1435362189575692182` + "\n")
+	in := bytes.Repeat(line, 1000)
+
+	b.ReportAllocs()
+	b.SetBytes(int64(len(in)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		s := canyon.NewScanner(in)
+		for s.Scan() {
+		}
+		if err := s.Err(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
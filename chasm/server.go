@@ -3,10 +3,15 @@ package chasm
 
 import (
 	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
 	"net"
 	"sync"
 	"time"
 
+	"github.com/mark-rushakoff/mountainflux/canyon"
 	"github.com/valyala/fasthttp"
 )
 
@@ -19,12 +24,50 @@ type Config struct {
 type HTTPConfig struct {
 	// TCP address to listen to, e.g. `:8086` or `0.0.0.0:8086`
 	Bind string `toml:"bind"`
+
+	// Paths to a PEM certificate and its key.
+	// If set, the server serves HTTPS instead of HTTP.
+	TLSCertFile string `toml:"tls-cert"`
+	TLSKeyFile  string `toml:"tls-key"`
+
+	// Path to a PEM file of CA certificates.
+	// If set, clients must present a certificate signed by one of these CAs (mutual TLS).
+	// Only used when serving HTTPS.
+	TLSClientCAFile string `toml:"tls-client-ca"`
+}
+
+// tlsConfig returns the TLS configuration described by c,
+// or nil if c doesn't specify a certificate.
+func (c *HTTPConfig) tlsConfig() (*tls.Config, error) {
+	if c.TLSCertFile == "" && c.TLSKeyFile == "" {
+		return nil, nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(c.TLSCertFile, c.TLSKeyFile)
+	if err != nil {
+		return nil, err
+	}
+	cfg := &tls.Config{Certificates: []tls.Certificate{cert}}
+
+	if c.TLSClientCAFile != "" {
+		pem, err := ioutil.ReadFile(c.TLSClientCAFile)
+		if err != nil {
+			return nil, err
+		}
+		cfg.ClientCAs = x509.NewCertPool()
+		if !cfg.ClientCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in TLS client CA file %s", c.TLSClientCAFile)
+		}
+		cfg.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	return cfg, nil
 }
 
 // Server is a fake InfluxDB server.
 type Server struct {
 	// HTTPURL is the read-only full address of this server after binding to the configured address,
-	// e.g. "http://example.com:8086"
+	// e.g. "http://example.com:8086", or "https://example.com:8086" when serving TLS.
 	HTTPURL string
 
 	httpListener net.Listener
@@ -44,12 +87,23 @@ func NewServer(c Config) (*Server, <-chan Stats, error) {
 	}
 
 	if c.HTTPConfig != nil {
-		var err error
+		tlsConfig, err := c.HTTPConfig.tlsConfig()
+		if err != nil {
+			return nil, nil, err
+		}
+
 		s.httpListener, err = net.Listen("tcp", c.HTTPConfig.Bind)
 		if err != nil {
 			return nil, nil, err
 		}
-		s.HTTPURL = "http://" + s.httpListener.Addr().String()
+
+		if tlsConfig != nil {
+			// Wrapping the listener, rather than using fasthttp's ServeTLS, allows requiring client certificates.
+			s.httpListener = tls.NewListener(s.httpListener, tlsConfig)
+			s.HTTPURL = "https://" + s.httpListener.Addr().String()
+		} else {
+			s.HTTPURL = "http://" + s.httpListener.Addr().String()
+		}
 	}
 
 	return s, s.stats, nil
@@ -73,7 +127,7 @@ func (s *Server) Close() {
 
 // Stats contains information about a request the server has accepted.
 type Stats struct {
-	// How many bytes were in the request.
+	// How many bytes were in the request body, as sent over the wire (i.e. compressed, if gzipped).
 	BytesAccepted int
 
 	// How many lines were in the request.
@@ -112,14 +166,25 @@ func (s *Server) serveHTTP() {
 }
 
 var (
-	lineDelimiter    = []byte("\n")
 	writePath        = []byte("/write")
 	dbKey            = []byte("db")
 	missingDbMessage = []byte("database is required")
+	contentEncoding  = []byte("Content-Encoding")
+	gzipEncoding     = []byte("gzip")
+
+	// InfluxDB 2.x write endpoint, which responds with JSON errors.
+	v2WritePath          = []byte("/api/v2/write")
+	bucketKey            = []byte("bucket")
+	orgKey               = []byte("org")
+	orgIDKey             = []byte("orgID")
+	missingBucketMessage = []byte(`{"code":"invalid","message":"bucket is required"}`)
+	missingOrgMessage    = []byte(`{"code":"invalid","message":"organization is required"}`)
 )
 
 func (s *Server) fasthttpHandler(ctx *fasthttp.RequestCtx) {
-	if !bytes.Equal(ctx.Path(), writePath) {
+	path := ctx.Path()
+	v2 := bytes.Equal(path, v2WritePath)
+	if !v2 && !bytes.Equal(path, writePath) {
 		ctx.Response.SetStatusCode(fasthttp.StatusNotFound)
 		return
 	}
@@ -129,18 +194,43 @@ func (s *Server) fasthttpHandler(ctx *fasthttp.RequestCtx) {
 		return
 	}
 
-	if args := ctx.QueryArgs(); args == nil || len(args.PeekBytes(dbKey)) == 0 {
+	args := ctx.QueryArgs()
+	if v2 {
+		if args == nil || len(args.PeekBytes(bucketKey)) == 0 {
+			ctx.Response.SetStatusCode(fasthttp.StatusBadRequest)
+			ctx.Response.Header.SetContentType("application/json")
+			ctx.Response.SetBody(missingBucketMessage)
+			return
+		}
+		if len(args.PeekBytes(orgKey)) == 0 && len(args.PeekBytes(orgIDKey)) == 0 {
+			ctx.Response.SetStatusCode(fasthttp.StatusBadRequest)
+			ctx.Response.Header.SetContentType("application/json")
+			ctx.Response.SetBody(missingOrgMessage)
+			return
+		}
+	} else if args == nil || len(args.PeekBytes(dbKey)) == 0 {
 		ctx.Response.SetStatusCode(fasthttp.StatusBadRequest)
 		ctx.Response.SetBody(missingDbMessage)
 		return
 	}
 
+	body := ctx.PostBody()
+	lines := body
+	if bytes.Equal(ctx.Request.Header.PeekBytes(contentEncoding), gzipEncoding) {
+		var err error
+		lines, err = ctx.Request.BodyGunzip()
+		if err != nil {
+			ctx.Response.SetStatusCode(fasthttp.StatusBadRequest)
+			ctx.Response.SetBody([]byte(err.Error()))
+			return
+		}
+	}
+
 	ctx.Response.SetStatusCode(fasthttp.StatusNoContent)
 
-	body := ctx.PostBody()
 	s.stats <- Stats{
 		BytesAccepted: len(body),
-		LinesAccepted: bytes.Count(body, lineDelimiter),
+		LinesAccepted: canyon.CountLines(lines),
 		IngestLatency: time.Since(ctx.ConnTime()).Nanoseconds(),
 		Time:          time.Now().UnixNano(),
 	}
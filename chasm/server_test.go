@@ -1,6 +1,8 @@
 package chasm_test
 
 import (
+	"bytes"
+	"compress/gzip"
 	"io"
 	"net/http"
 	"strings"
@@ -59,3 +61,137 @@ func TestServer_HTTPWrite(t *testing.T) {
 		}
 	}
 }
+
+var httpV2Tests = []struct {
+	method      string
+	queryParams string
+	expStatus   int
+}{
+	{"POST", "org=o&bucket=b", http.StatusNoContent},
+	{"POST", "orgID=1234&bucket=b", http.StatusNoContent},
+	{"POST", "org=o", http.StatusBadRequest},
+	{"POST", "bucket=b", http.StatusBadRequest},
+	{"GET", "org=o&bucket=b", http.StatusMethodNotAllowed},
+}
+
+func TestServer_HTTPWriteV2(t *testing.T) {
+	s, serverStats, err := chasm.NewServer(chasm.Config{
+		HTTPConfig: &chasm.HTTPConfig{
+			Bind: "localhost:0",
+		},
+	})
+	if err != nil {
+		t.Fatalf("exp no error, got: %s", err.Error())
+	}
+	s.Serve()
+	go func() {
+		for range serverStats {
+			// Nothing, just consume the channel.
+		}
+	}()
+	defer s.Close()
+
+	c := &http.Client{}
+	for _, ht := range httpV2Tests {
+		var body io.Reader
+		if ht.method == "POST" {
+			body = strings.NewReader("m f=1")
+		}
+		req, err := http.NewRequest(ht.method, s.HTTPURL+"/api/v2/write?"+ht.queryParams, body)
+		if err != nil {
+			t.Errorf("exp no error, got: %s", err.Error())
+			continue
+		}
+
+		resp, err := c.Do(req)
+		if err != nil {
+			t.Errorf("exp no error, got: %s", err.Error())
+			continue
+		}
+
+		if resp.StatusCode != ht.expStatus {
+			t.Errorf("%s %s: exp status: %d, got: %d", ht.method, ht.queryParams, ht.expStatus, resp.StatusCode)
+		}
+		if resp.StatusCode == http.StatusBadRequest && resp.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("%s %s: exp JSON error, got content type: %s", ht.method, ht.queryParams, resp.Header.Get("Content-Type"))
+		}
+	}
+}
+
+var linesAcceptedTests = []struct {
+	body     string
+	expLines int
+}{
+	{"m f=1 1458507416458236266\n", 1},
+	{"m f=1\n", 1},
+	{"m f=1", 1},
+	{"m f=1 1458507416458236266\nm f=2\nm f=3 1458507416458236268\n", 3},
+	{"m f=1 1458507416458236266\nm f=2", 2},
+	{"m s=\"a\nb\" 1458507416458236266\nm f=2\n", 2},
+}
+
+func TestServer_HTTPWriteLinesAccepted(t *testing.T) {
+	s, serverStats, err := chasm.NewServer(chasm.Config{
+		HTTPConfig: &chasm.HTTPConfig{
+			Bind: "localhost:0",
+		},
+	})
+	if err != nil {
+		t.Fatalf("exp no error, got: %s", err.Error())
+	}
+	s.Serve()
+	defer s.Close()
+
+	for _, lt := range linesAcceptedTests {
+		resp, err := http.Post(s.HTTPURL+"/write?db=x", "text/plain", strings.NewReader(lt.body))
+		if err != nil {
+			t.Fatalf("exp no error, got: %s", err.Error())
+		}
+		resp.Body.Close()
+
+		stats := <-serverStats
+		if stats.LinesAccepted != lt.expLines {
+			t.Errorf("body %q: exp lines: %d, got: %d", lt.body, lt.expLines, stats.LinesAccepted)
+		}
+	}
+}
+
+func TestServer_HTTPWriteGzip(t *testing.T) {
+	s, serverStats, err := chasm.NewServer(chasm.Config{
+		HTTPConfig: &chasm.HTTPConfig{
+			Bind: "localhost:0",
+		},
+	})
+	if err != nil {
+		t.Fatalf("exp no error, got: %s", err.Error())
+	}
+	s.Serve()
+	defer s.Close()
+
+	var body bytes.Buffer
+	zw := gzip.NewWriter(&body)
+	zw.Write([]byte("m f=1\nm f=2\nm f=3\n"))
+	zw.Close()
+
+	req, err := http.NewRequest("POST", s.HTTPURL+"/write?db=x", bytes.NewReader(body.Bytes()))
+	if err != nil {
+		t.Fatalf("exp no error, got: %s", err.Error())
+	}
+	req.Header.Set("Content-Encoding", "gzip")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("exp no error, got: %s", err.Error())
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("exp status: %d, got: %d", http.StatusNoContent, resp.StatusCode)
+	}
+
+	stats := <-serverStats
+	if stats.LinesAccepted != 3 {
+		t.Errorf("exp lines: 3, got: %d", stats.LinesAccepted)
+	}
+	if stats.BytesAccepted != body.Len() {
+		t.Errorf("exp bytes: %d, got: %d", body.Len(), stats.BytesAccepted)
+	}
+}
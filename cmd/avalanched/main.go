@@ -3,26 +3,34 @@ package main
 import (
 	"bufio"
 	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"log"
 	"os"
 	"os/signal"
 	"runtime"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/mark-rushakoff/mountainflux/avalanche"
+	"github.com/mark-rushakoff/mountainflux/canyon"
 	"github.com/mark-rushakoff/mountainflux/river"
 )
 
 var (
 	logger = log.New(os.Stdout, "[avalanched] ", log.LstdFlags)
 
-	// One WaitGroup for the HTTP writers
-	workersWg sync.WaitGroup
+	// Batches input lines and writes each batch with the next free worker's writer.
+	batchWriter *avalanche.BatchingWriter
 
-	// Separate WaitGroup for the stats writer (so that it can flush the last set of stats when workers shut down)
+	// Channel closed once batchWriter has written every batch, or abandoned them during shutdown.
+	writesDone = make(chan struct{})
+
+	// WaitGroup for the stats writer (so that it can flush the last set of stats when workers shut down)
 	statsWg sync.WaitGroup
 
 	bufPool = sync.Pool{
@@ -31,97 +39,297 @@ var (
 		},
 	}
 
-	// Input scanner sends buffers over this channel, writer workers read from it.
-	// Created at runtime with buffer size equivalent to number of workers.
-	batchChan chan *bytes.Buffer
-
 	// Channel closed by input scanner when input EOF reached.
 	// Indicates to rest of application that it is time to shut down.
 	inputDone = make(chan struct{})
 
 	// Channel closed by shutdown function.
-	// Indicates to stat flushing function to do one last flush.
+	// Indicates to stat flushing function to do one last flush once every batch has been written.
 	quit = make(chan struct{})
 
+	// Context for closing batchWriter, canceled if graceful shutdown takes too long
+	// so that workers stop waiting on in-flight requests and on the schedule.
+	writeCtx, cancelWrites = context.WithCancel(context.Background())
+
+	// Set if writing to a file instead of a target server; closed once the workers are done.
+	fileWriter *avalanche.FileWriter
+
 	statMu  sync.Mutex
 	statBuf *bytes.Buffer = bufPool.Get().(*bytes.Buffer)
 )
 
 func main() {
-	url := flag.String("httpurl", "localhost:8086", "host:port for target HTTP server")
+	url := flag.String("httpurl", "localhost:8086", "host:port for target HTTP server, or a full URL such as https://host:port; separate multiple servers with commas")
+	distribution := flag.String("distribution", "roundrobin", "How to distribute writes among multiple target HTTP servers: roundrobin, leastoutstanding, or hash (by series key)")
+	teeURLs := flag.String("teeurls", "", "Comma-separated host:port or URLs of additional HTTP servers, such as chasmd, to which every batch is also written concurrently; stats are recorded for each target")
+	ejectFor := flag.Duration("ejectFor", 10*time.Second, "How long to stop writing to one of multiple target HTTP servers after it fails")
+	udpAddr := flag.String("udpaddr", "", "host:port for target UDP listener; if set, writes are sent over UDP instead of HTTP")
+	udpPayloadSize := flag.Int("udpPayloadSize", avalanche.DefaultUDPPayloadSize, "Maximum payload size in bytes of each UDP datagram")
 	database := flag.String("database", "", "target database for writes")
+	retentionPolicy := flag.String("rp", "", "target retention policy for writes (defaults to the database's default retention policy)")
+	consistency := flag.String("consistency", "", "write consistency for clustered InfluxDB: any, one, quorum, or all (defaults to the server's default)")
+	org := flag.String("org", "", "target organization for writes to InfluxDB 2.x")
+	bucket := flag.String("bucket", "", "target bucket for writes to InfluxDB 2.x (use instead of -database)")
+	username := flag.String("username", "", "username for target HTTP server, if it requires authentication")
+	password := flag.String("password", "", "password for target HTTP server, if it requires authentication")
+	token := flag.String("token", "", "token for target HTTP server, if it uses token authentication (overrides username and password)")
+	outFile := flag.String("outfile", "", "Write batches to this file, or - for stdout, instead of a target server, e.g. to record a workload for replay")
+	outFileMaxBytes := flag.Int64("outfileMaxBytes", 0, "Rotate -outfile after this many bytes, before compression (0 to never rotate)")
+	useGzip := flag.Bool("gzip", false, "gzip-compress HTTP request bodies, or -outfile")
+	gzipLevel := flag.Int("gzipLevel", gzip.DefaultCompression, "gzip compression level, from 1 (best speed) to 9 (best compression)")
+	precision := flag.String("precision", "ns", "precision of timestamps in input lines (ns, us, ms, or s)")
+	tlsCA := flag.String("tlsCA", "", "PEM file of CA certificates to verify an HTTPS target server (defaults to the system's CA certificates)")
+	tlsCert := flag.String("tlsCert", "", "PEM client certificate for an HTTPS target server that requires mutual TLS")
+	tlsKey := flag.String("tlsKey", "", "PEM key for -tlsCert")
+	insecureSkipVerify := flag.Bool("insecureSkipVerify", false, "Skip verification of an HTTPS target server's certificate")
+	timeout := flag.Duration("timeout", 0, "Maximum time to wait for each HTTP write request (0 for no timeout)")
 
 	linesPerBatch := flag.Int("linesPerBatch", 100, "How many lines to collect before initiating a write")
+	batchesPerSec := flag.Float64("batchesPerSec", 0, "Dispatch batches on a fixed schedule at this rate across all workers, measuring latency from each batch's scheduled send time (0 to write as fast as workers allow)")
 	numWorkers := flag.Int("workers", 8*runtime.GOMAXPROCS(0), "Number of workers to concurrently send requests to target server")
 
-	statsURL := flag.String("statsurl", "", "host:port for stats server (to report write throughput)")
+	maxAttempts := flag.Int("maxAttempts", 1, "Maximum number of attempts per batch; batches failing with 5xx, 429, or transport errors are retried")
+	retryBackoff := flag.Duration("retryBackoff", 100*time.Millisecond, "Time to wait before the first retry; doubles with each subsequent retry")
+	retryJitter := flag.Float64("retryJitter", 0.2, "Fraction by which each retry backoff is randomly adjusted")
+
+	linesPerSec := flag.Float64("linesPerSec", 0, "Maximum lines written per second across all workers (0 for unlimited)")
+	bytesPerSec := flag.Float64("bytesPerSec", 0, "Maximum bytes written per second across all workers, before compression (0 for unlimited)")
+
+	statsURL := flag.String("statsurl", "", "host:port for stats server (to report write throughput), or a full URL such as https://host:port")
 	statsDatabase := flag.String("statsdb", "", "database to use on stats server")
+	statsOrg := flag.String("statsorg", "", "organization to use on stats server, if it is InfluxDB 2.x")
+	statsBucket := flag.String("statsbucket", "", "bucket to use on stats server, if it is InfluxDB 2.x (use instead of -statsdb)")
+	statsUsername := flag.String("statsusername", "", "username for stats server, if it requires authentication")
+	statsPassword := flag.String("statspassword", "", "password for stats server, if it requires authentication")
+	statsToken := flag.String("statstoken", "", "token for stats server, if it uses token authentication (overrides username and password)")
 
 	// TODO: statsKey ought to include the target url.
 	defaultStatsKey := string(river.SeriesKey("avalanched", map[string]string{"pid": fmt.Sprintf("%d", os.Getpid())}))
 	statsKey := flag.String("statskey", defaultStatsKey, "Series key to use to report stats")
 	flag.Parse()
 
-	if database == nil || *database == "" {
-		logger.Fatalf("no database provided (use e.g. -database=mydb)")
+	if *outFile == avalanche.Stdout {
+		// Keep logs out of the recorded workload.
+		logger.SetOutput(os.Stderr)
+	}
+
+	if *outFile == "" && *database == "" && *bucket == "" {
+		logger.Fatalf("no database or bucket provided (use e.g. -database=mydb, or -bucket=mybucket for InfluxDB 2.x)")
 	}
 
 	if statsURL == nil || *statsURL == "" {
 		logger.Fatalf("no stats server provided (use e.g. -statsurl=localhost:8086)")
 	}
 
-	if statsDatabase == nil || *statsDatabase == "" {
-		logger.Fatalf("no stats database provided (use e.g. -statsdb=mydb)")
+	if *statsDatabase == "" && *statsBucket == "" {
+		logger.Fatalf("no stats database or bucket provided (use e.g. -statsdb=mydb, or -statsbucket=mybucket for InfluxDB 2.x)")
+	}
+
+	p, err := river.ParsePrecision(*precision)
+	if err != nil {
+		logger.Fatal(err)
+	}
+
+	dist, err := avalanche.ParseDistribution(*distribution)
+	if err != nil {
+		logger.Fatal(err)
 	}
 
-	batchChan = make(chan *bytes.Buffer, *numWorkers)
+	if *linesPerBatch <= 0 {
+		logger.Fatalf("linesPerBatch must be > 0")
+	}
+	if *numWorkers <= 0 {
+		logger.Fatalf("workers must be > 0")
+	}
+
+	// Start the requested number of workers to make write requests over HTTP.
+	c := avalanche.HTTPWriterConfig{
+		Database:        *database,
+		RetentionPolicy: *retentionPolicy,
+		Consistency:     *consistency,
+		Org:             *org,
+		Bucket:          *bucket,
+		Username:        *username,
+		Password:        *password,
+		Token:           *token,
+		Precision:       p,
+		Timeout:         *timeout,
+		Gzip:            *useGzip,
+		GzipLevel:       *gzipLevel,
+
+		TLSCAFile:          *tlsCA,
+		TLSCertFile:        *tlsCert,
+		TLSKeyFile:         *tlsKey,
+		InsecureSkipVerify: *insecureSkipVerify,
+	}
+
+	// With multiple target servers, all workers share one MultiWriter,
+	// so that it can balance writes and eject failing servers based on every write.
+	var multiWriter *avalanche.MultiWriter
+	hosts := strings.Split(*url, ",")
+	if len(hosts) > 1 {
+		cs := make([]avalanche.HTTPWriterConfig, len(hosts))
+		for i, h := range hosts {
+			cs[i] = c
+			cs[i].Host = hostURL(h)
+		}
+		multiWriter = avalanche.NewMultiHTTPWriter(cs, avalanche.MultiWriterConfig{
+			Distribution: dist,
+			EjectFor:     *ejectFor,
+		})
+	} else {
+		c.Host = hostURL(*url)
+	}
+	udpConfig := avalanche.UDPWriterConfig{
+		Addr:        *udpAddr,
+		PayloadSize: *udpPayloadSize,
+	}
+	var limiter *avalanche.RateLimiter
+	if *linesPerSec > 0 || *bytesPerSec > 0 {
+		limiter = avalanche.NewRateLimiter(avalanche.RateLimitConfig{
+			LinesPerSecond: *linesPerSec,
+			BytesPerSecond: *bytesPerSec,
+		})
+	}
+	if *outFile != "" {
+		// All workers share one file, so that every batch is written whole.
+		fileWriter, err = avalanche.NewFileWriter(avalanche.FileWriterConfig{
+			Path:      *outFile,
+			Gzip:      *useGzip,
+			GzipLevel: *gzipLevel,
+			MaxBytes:  *outFileMaxBytes,
+		})
+		if err != nil {
+			logger.Fatalf("Error creating output file: %s", err.Error())
+		}
+	}
+
+	withRetries := func(w avalanche.LineProtocolWriter) avalanche.LineProtocolWriter {
+		if *maxAttempts <= 1 {
+			return w
+		}
+		return avalanche.NewRetryWriter(w, avalanche.RetryConfig{
+			MaxAttempts:    *maxAttempts,
+			InitialBackoff: *retryBackoff,
+			Jitter:         *retryJitter,
+			OnAttempt:      logFailedAttempt,
+		})
+	}
+	var teeHosts []string
+	if *teeURLs != "" {
+		teeHosts = strings.Split(*teeURLs, ",")
+	}
+	writers := make([]avalanche.LineProtocolWriter, *numWorkers)
+	for i := range writers {
+		var w avalanche.LineProtocolWriter
+		var target string
+		if fileWriter != nil {
+			w = fileWriter
+			target = "file://" + *outFile
+		} else if udpConfig.Addr != "" {
+			uw, err := avalanche.NewUDPWriter(udpConfig)
+			if err != nil {
+				logger.Fatalf("Error creating UDP writer: %s", err.Error())
+			}
+			w = uw
+			target = "udp://" + udpConfig.Addr
+		} else if multiWriter != nil {
+			w = multiWriter
+			target = *url
+		} else {
+			w = avalanche.NewHTTPWriter(c)
+			target = c.Host
+		}
+		w = withRetries(w)
+		if len(teeHosts) > 0 {
+			// Retry each target independently, so that one failing target doesn't cause duplicate writes to the others.
+			targets := []avalanche.LineProtocolWriter{newTargetStatsWriter(w, []byte(*statsKey), target)}
+			for _, h := range teeHosts {
+				tc := c
+				tc.Host = hostURL(h)
+				tw := withRetries(avalanche.NewHTTPWriter(tc))
+				targets = append(targets, newTargetStatsWriter(tw, []byte(*statsKey), tc.Host))
+			}
+			w = avalanche.NewTeeWriter(targets...)
+		}
+		if limiter != nil {
+			// Limit outside of any retries, so that the rate limit caps the offered load of new batches.
+			w = avalanche.NewRateLimitedWriter(w, limiter)
+		}
+		writers[i] = w
+	}
 
 	// One goroutine to periodically flush stats.
 	statsWg.Add(1)
 	statConfig := avalanche.HTTPWriterConfig{
-		Host:     "http://" + *statsURL,
+		Host:     hostURL(*statsURL),
 		Database: *statsDatabase,
+		Org:      *statsOrg,
+		Bucket:   *statsBucket,
+		Username: *statsUsername,
+		Password: *statsPassword,
+		Token:    *statsToken,
 	}
-	go recordStats(avalanche.NewHTTPWriter(statConfig))
+	go recordStats(avalanche.NewHTTPWriter(statConfig), []byte(*statsKey), multiWriter)
 	logger.Printf("Recording stats to %s with series key: %s\n", statConfig.Host, *statsKey)
 
-	// Start the requested number of workers to make write requests over HTTP.
-	c := avalanche.HTTPWriterConfig{
-		Host:     "http://" + *url,
-		Database: *database,
+	if fileWriter != nil {
+		logger.Println("Beginning writes to file", *outFile)
+	} else if udpConfig.Addr != "" {
+		logger.Println("Beginning UDP writes to", udpConfig.Addr)
+	} else if multiWriter != nil {
+		logger.Printf("Beginning writes to %s, distributed %s\n", strings.Join(hosts, ", "), dist)
+	} else {
+		logger.Println("Beginning writes to", c.Host)
+	}
+	if len(teeHosts) > 0 {
+		logger.Println("Also writing every batch to", strings.Join(teeHosts, ", "))
+	}
+
+	// In open-loop mode, batches are written on a fixed schedule rather than as soon as a worker is free.
+	var sched *avalanche.Schedule
+	if *batchesPerSec > 0 {
+		interval := time.Duration(float64(time.Second) / *batchesPerSec)
+		sched = avalanche.NewSchedule(interval)
+		logger.Printf("Dispatching a batch every %v\n", interval)
 	}
-	workersWg.Add(*numWorkers)
-	for i := 0; i < *numWorkers; i++ {
-		w := avalanche.NewHTTPWriter(c)
-		go processBatches([]byte(*statsKey), w, batchChan)
+
+	batchWriter, err = avalanche.NewBatchingWriter(avalanche.BatchingWriterConfig{
+		MaxLines:  *linesPerBatch,
+		QueueSize: *numWorkers,
+		Schedule:  sched,
+		OnWrite:   newBatchRecorder([]byte(*statsKey), sched != nil),
+	}, writers...)
+	if err != nil {
+		logger.Fatalf("Error creating batching writer: %s", err.Error())
 	}
-	logger.Println("Beginning writes to", c.Host)
 
 	// Read input on a separate goroutine.
-	// Synchronization unnecessary here - if workers are stopped, input scanner will eventually fill the batchChan and block.
-	go scan(*linesPerBatch)
+	// Synchronization unnecessary here - if workers are stopped, batchWriter will eventually fill its queue and block the input scanner.
+	go scan()
 
 	// Wait for either ctrl-c or end of input
 	waitForInterrupt()
 }
 
-// scan reads one line at a time from stdin.
-// When the requested number of lines per batch is met, send a batch over batchChan for the workers to write.
-func scan(linesPerBatch int) {
-	buf := bufPool.Get().(*bytes.Buffer)
+// hostURL returns the URL for a host given on the command line,
+// which defaults to http if no scheme is given.
+func hostURL(host string) string {
+	if strings.Contains(host, "://") {
+		return host
+	}
+	return "http://" + host
+}
 
-	var n int
+// scan reads one line at a time from stdin, keeping any newlines in quoted string field values within their line,
+// and adds each line to batchWriter.
+func scan() {
 	scanner := bufio.NewScanner(os.Stdin)
+	scanner.Split(canyon.ScanLines)
 	for scanner.Scan() {
-		// *Probably* safe to append to scanner.Bytes this way, to avoid an extra call to buf.WriteByte('\n').
-		b := append(scanner.Bytes(), '\n')
-		buf.Write(b)
-
-		n++
-		if n >= linesPerBatch {
-			batchChan <- buf
-			buf = bufPool.Get().(*bytes.Buffer)
-			n = 0
+		if err := batchWriter.WriteLine(scanner.Bytes()); err != nil {
+			// batchWriter was closed by an interrupt.
+			return
 		}
 	}
 
@@ -129,56 +337,141 @@ func scan(linesPerBatch int) {
 		logger.Fatalf("Error reading input: %s", err.Error())
 	}
 
-	// Finished reading input, make sure last batch goes out.
-	if n > 0 {
-		batchChan <- buf
-	}
-
 	// Closing inputDone signals to the application that we've read everything and can now shut down.
 	close(inputDone)
 }
 
-// processBatches reads byte buffers from batchChan and writes them to the target server, while tracking stats on the write.
-func processBatches(statsKey []byte, w avalanche.LineProtocolWriter, batchChan <-chan *bytes.Buffer) {
-	// Fields to hold write stats.
+// newBatchRecorder returns a function to track stats on each batch written by batchWriter.
+// In open-loop mode, latency is measured from each batch's scheduled send time,
+// and the time each batch waited past its schedule is also recorded.
+// Failed writes are recorded with an additional error tag, categorizing the failure,
+// and the number of points the server reported dropping.
+func newBatchRecorder(statsKey []byte, openLoop bool) func(avalanche.BatchResult) {
+	// Fields to hold write stats, guarded by statMu.
 	latField := river.Int{Name: []byte("latNs")}
 	successField := river.Bool{Name: []byte("ok")}
 	payloadField := river.Int{Name: []byte("payloadBytes")}
+	delayField := river.Int{Name: []byte("delayNs")}
+	droppedField := river.Int{Name: []byte("droppedPoints")}
 	fields := []river.Field{&latField, &successField, &payloadField}
+	if openLoop {
+		fields = append(fields, &delayField)
+	}
+	errFields := append(fields[:len(fields):len(fields)], &droppedField)
 
-	for batch := range batchChan {
-		// Write the batch.
-		latNs, err := w.WriteLineProtocol(batch.Bytes())
-		if err != nil {
-			logger.Printf("Error writing: %s\n", err.Error())
+	// Series keys for failed writes, by error category, guarded by statMu.
+	errKeys := make(map[avalanche.ErrorCategory][]byte)
+
+	return func(r avalanche.BatchResult) {
+		if r.Err != nil {
+			logger.Printf("Error writing: %s\n", r.Err.Error())
 		}
 
-		// Track stats for the batch.
 		statMu.Lock()
+		defer statMu.Unlock()
+
 		ts := time.Now().UnixNano()
-		latField.Value = latNs
-		successField.Value = err == nil
-		payloadField.Value = int64(batch.Len())
-		river.WriteLine(statBuf, statsKey, fields, ts)
-		statMu.Unlock()
+		latField.Value = r.LatencyNs
+		successField.Value = r.Err == nil
+		payloadField.Value = int64(r.Bytes)
+		delayField.Value = r.DelayNs
+		if r.Err == nil {
+			river.WriteLine(statBuf, statsKey, fields, ts)
+			return
+		}
+
+		c := avalanche.Categorize(r.Err)
+		key, ok := errKeys[c]
+		if !ok {
+			key = append(append(statsKey[:len(statsKey):len(statsKey)], ",error="...), c...)
+			errKeys[c] = key
+		}
+		droppedField.Value = 0
+		var we *avalanche.WriteError
+		if errors.As(r.Err, &we) {
+			droppedField.Value = int64(we.DroppedPoints)
+		}
+		river.WriteLine(statBuf, key, errFields, ts)
+	}
+}
+
+// targetStatsWriter records the latency and outcome of every write to one target of a tee,
+// using the stats series key with additional target and, for failed writes, error tags.
+type targetStatsWriter struct {
+	w avalanche.ContextLineProtocolWriter
+
+	key     []byte
+	errKeys map[avalanche.ErrorCategory][]byte
 
-		// Return the batch buffer to the pool.
-		batch.Reset()
-		bufPool.Put(batch)
+	// Guarded by statMu.
+	latField     river.Int
+	successField river.Bool
+	fields       []river.Field
+}
+
+func newTargetStatsWriter(w avalanche.LineProtocolWriter, statsKey []byte, target string) *targetStatsWriter {
+	t := &targetStatsWriter{
+		w:            avalanche.WithContext(w),
+		key:          append(statsKey[:len(statsKey):len(statsKey)], ",target="+tagValueEscaper.Replace(target)...),
+		errKeys:      make(map[avalanche.ErrorCategory][]byte),
+		latField:     river.Int{Name: []byte("targetLatNs")},
+		successField: river.Bool{Name: []byte("targetOk")},
+	}
+	t.fields = []river.Field{&t.latField, &t.successField}
+	return t
+}
+
+func (t *targetStatsWriter) WriteLineProtocol(body []byte) (int64, error) {
+	return t.WriteLineProtocolContext(context.Background(), body)
+}
+
+func (t *targetStatsWriter) WriteLineProtocolContext(ctx context.Context, body []byte) (int64, error) {
+	latNs, err := t.w.WriteLineProtocolContext(ctx, body)
+
+	key := t.key
+	if err != nil {
+		c := avalanche.Categorize(err)
+		var ok bool
+		if key, ok = t.errKeys[c]; !ok {
+			key = append(t.key[:len(t.key):len(t.key)], ",error="...)
+			key = append(key, c...)
+			t.errKeys[c] = key
+		}
+	}
+
+	statMu.Lock()
+	t.latField.Value = latNs
+	t.successField.Value = err == nil
+	river.WriteLine(statBuf, key, t.fields, time.Now().UnixNano())
+	statMu.Unlock()
+
+	return latNs, err
+}
+
+// logFailedAttempt logs any failed attempt at writing a batch that may be retried.
+func logFailedAttempt(attempt int, latNs int64, err error) {
+	if err != nil {
+		logger.Printf("Attempt %d failed after %v: %s\n", attempt, time.Duration(latNs), err.Error())
 	}
-	workersWg.Done()
 }
 
 // recordStats periodically tries to flush stats to stats server.
 // Also flushes stats if application is shutting down.
-func recordStats(statsW avalanche.LineProtocolWriter) {
+// If mw is set, the stats of each of its endpoints are recorded before each flush.
+func recordStats(statsW avalanche.LineProtocolWriter, statsKey []byte, mw *avalanche.MultiWriter) {
 	t := time.NewTicker(3 * time.Second)
 	for {
 		select {
 		case <-t.C:
+			if mw != nil {
+				recordEndpointStats(statsKey, mw)
+			}
 			flushStats(statsW)
 		case <-quit:
-			workersWg.Wait()
+			<-writesDone
+			if mw != nil {
+				recordEndpointStats(statsKey, mw)
+			}
 			flushStats(statsW)
 			t.Stop()
 			statsWg.Done()
@@ -187,6 +480,36 @@ func recordStats(statsW avalanche.LineProtocolWriter) {
 	}
 }
 
+var tagValueEscaper = strings.NewReplacer(",", `\,`, "=", `\=`, " ", `\ `)
+
+// recordEndpointStats records the cumulative stats of each of mw's endpoints,
+// using statsKey with an additional endpoint tag.
+func recordEndpointStats(statsKey []byte, mw *avalanche.MultiWriter) {
+	writesField := river.Int{Name: []byte("endpointWrites")}
+	errorsField := river.Int{Name: []byte("endpointErrors")}
+	latField := river.Int{Name: []byte("endpointLatNs")}
+	outstandingField := river.Int{Name: []byte("endpointOutstanding")}
+	ejectionsField := river.Int{Name: []byte("endpointEjections")}
+	ejectedField := river.Bool{Name: []byte("endpointEjected")}
+	fields := []river.Field{&writesField, &errorsField, &latField, &outstandingField, &ejectionsField, &ejectedField}
+
+	stats := mw.Stats()
+	ts := time.Now().UnixNano()
+
+	statMu.Lock()
+	defer statMu.Unlock()
+	for _, s := range stats {
+		key := append(statsKey[:len(statsKey):len(statsKey)], ",endpoint="+tagValueEscaper.Replace(s.Name)...)
+		writesField.Value = s.Writes
+		errorsField.Value = s.Errors
+		latField.Value = s.LatencyNs
+		outstandingField.Value = s.Outstanding
+		ejectionsField.Value = s.Ejections
+		ejectedField.Value = s.Ejected
+		river.WriteLine(statBuf, key, fields, ts)
+	}
+}
+
 // Send stats to stats server, if there are any stats to write.
 func flushStats(statsW avalanche.LineProtocolWriter) {
 	// Temporary buffer so we can save stats while workers record stats.
@@ -228,14 +551,22 @@ func waitForInterrupt() {
 }
 
 // shutdown signals to other goroutines to shut down.
-// If the other goroutines don't finish in time, forcefully shut down the application.
+// If the other goroutines don't finish in time, in-flight writes are canceled
+// to give the last stats a chance to flush before forcefully shutting down the application.
 func shutdown() {
 	done := make(chan struct{})
 
 	go func() {
-		close(batchChan)
 		close(quit)
-		workersWg.Wait()
+		if err := batchWriter.CloseContext(writeCtx); err != nil {
+			logger.Printf("Abandoned remaining batches: %s", err.Error())
+		}
+		close(writesDone)
+		if fileWriter != nil {
+			if err := fileWriter.Close(); err != nil {
+				logger.Printf("Error closing output file: %s", err.Error())
+			}
+		}
 		statsWg.Wait()
 		done <- struct{}{}
 	}()
@@ -243,7 +574,13 @@ func shutdown() {
 	select {
 	case <-done:
 	case <-time.After(3 * time.Second):
-		logger.Printf("Graceful shutdown not completed in time. Aborting...")
+		logger.Printf("Graceful shutdown not completed in time. Canceling in-flight writes...")
+		cancelWrites()
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+		}
+		logger.Printf("Aborting...")
 		os.Exit(1)
 	}
 
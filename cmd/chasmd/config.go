@@ -12,6 +12,13 @@ const sampleConfigText = `[http]
 # Bind address for HTTP server.
 bind = "0.0.0.0:8086"
 
+# Certificate and key to serve HTTPS instead of HTTP.
+# tls-cert = "/etc/chasmd/cert.pem"
+# tls-key = "/etc/chasmd/key.pem"
+
+# When serving HTTPS, require clients to present a certificate signed by one of these CAs.
+# tls-client-ca = "/etc/chasmd/client-ca.pem"
+
 # Stats can be collected about each HTTP connection received.
 # Comment out or remove the stats section if you don't want to track stats.
 [stats]
@@ -21,6 +28,25 @@ host = "http://192.0.2.1:8086"
 # Target database for stats
 database = "chasmd"
 
+# Or, if the stats host is InfluxDB 2.x, target organization and bucket for stats.
+# Bucket overrides database.
+# org = "my-org"
+# bucket = "chasmd"
+
+# Credentials for the stats host, if it requires authentication.
+# username = "chasmd"
+# password = "secret"
+
+# Token for the stats host, if it uses token authentication, e.g. InfluxDB 2.x.
+# Overrides username and password.
+# token = "secret-token"
+
+# Or, write stats as line protocol to a file instead of the stats host ("-" for stdout).
+# file = "chasmd-stats.lp"
+# Optionally gzip the file, and rotate it after this many bytes (before compression).
+# file-gzip = false
+# file-max-bytes = 0
+
 # Template for series key when sending stats.
 # Valid functions in template: pid
 # TODO: Add env function
@@ -38,18 +64,20 @@ type chasmConfig struct {
 	Stats statsConfig      `toml:"stats,omitempty"`
 }
 
-type httpConfig struct {
-	Bind string `toml:"bind"`
-
-	// TODO: response latency configuration?
-}
-
 type statsConfig struct {
-	Host       string `toml:"host"`
-	Database   string `toml:"database"`
-	SeriesKey  string `toml:"series-key"`
-	BatchSize  int    `toml:"batch-size"`
-	NumWorkers int    `toml:"workers"`
+	Host         string `toml:"host"`
+	Database     string `toml:"database"`
+	Org          string `toml:"org"`
+	Bucket       string `toml:"bucket"`
+	Username     string `toml:"username"`
+	Password     string `toml:"password"`
+	Token        string `toml:"token"`
+	File         string `toml:"file"`
+	FileGzip     bool   `toml:"file-gzip"`
+	FileMaxBytes int64  `toml:"file-max-bytes"`
+	SeriesKey    string `toml:"series-key"`
+	BatchSize    int    `toml:"batch-size"`
+	NumWorkers   int    `toml:"workers"`
 }
 
 func (s *statsConfig) FinalizeSeriesKey() {
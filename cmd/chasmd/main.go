@@ -1,7 +1,6 @@
 package main
 
 import (
-	"bytes"
 	"flag"
 	"fmt"
 	"log"
@@ -24,14 +23,10 @@ var (
 	configPath   = flag.String("config", "chasmd.toml", "Path to chasmd configuration file")
 	sampleConfig = flag.Bool("sample-config", false, "If set, print out sample configuration and exit")
 
-	wg      sync.WaitGroup
-	bufPool = sync.Pool{
-		New: func() interface{} {
-			// Just guessing on the initial buffer size here.
-			return bytes.NewBuffer(make([]byte, 0, 1024*16))
-		},
-	}
-	statPayloads chan *bytes.Buffer
+	wg sync.WaitGroup
+
+	// Set if stats are written to a file instead of a stats host; closed once the stat workers are done.
+	statsFile *avalanche.FileWriter
 )
 
 func main() {
@@ -50,6 +45,10 @@ func main() {
 	if err := toml.NewDecoder(f).Decode(&cfg); err != nil {
 		logger.Fatalf(err.Error())
 	}
+	if cfg.Stats.File == avalanche.Stdout {
+		// Keep logs out of the recorded stats.
+		logger.SetOutput(os.Stderr)
+	}
 	cfg.Stats.FinalizeSeriesKey()
 	logger.Println("Recording stats with series key:", cfg.Stats.SeriesKey)
 
@@ -57,12 +56,12 @@ func main() {
 		logger.Fatalf("stats.workers must be > 0")
 	}
 
-	statPayloads = make(chan *bytes.Buffer, cfg.Stats.NumWorkers)
+	if cfg.Stats.BatchSize <= 0 {
+		logger.Fatalf("stats.batch-size must be > 0")
+	}
 
 	c := chasm.Config{
-		HTTPConfig: &chasm.HTTPConfig{
-			Bind: cfg.HTTP.Bind,
-		},
+		HTTPConfig: &cfg.HTTP,
 	}
 
 	s, serverStats, err := chasm.NewServer(c)
@@ -70,10 +69,16 @@ func main() {
 		logger.Fatal("Unexpected error:", err.Error())
 	}
 
-	wg.Add(1)
-	go collectServerStats(serverStats)
+	bw, err := avalanche.NewBatchingWriter(avalanche.BatchingWriterConfig{
+		MaxLines: cfg.Stats.BatchSize,
+		OnWrite:  logStatsError,
+	}, statWriters()...)
+	if err != nil {
+		logger.Fatal("Unexpected error:", err.Error())
+	}
 
-	spawnStatWorkers()
+	wg.Add(1)
+	go collectServerStats(serverStats, bw)
 
 	s.Serve()
 	logger.Println("HTTP server listening on", s.HTTPURL)
@@ -88,11 +93,9 @@ func main() {
 }
 
 // collectServerStats is intended to be run in a single goroutine.
-// Collects stats from the server into batches and sends off to stat reporters.
-func collectServerStats(serverStats <-chan chasm.Stats) {
-	buf := bufPool.Get().(*bytes.Buffer)
-	curLines := 0
-	maxLines := cfg.Stats.BatchSize
+// Collects stats from the server into bw, which batches them and sends them off to the stat writers.
+func collectServerStats(serverStats <-chan chasm.Stats, bw *avalanche.BatchingWriter) {
+	var line []byte
 
 	sk := []byte(cfg.Stats.SeriesKey)
 	bytesAccepted := river.Int{Name: []byte("bytes")}
@@ -109,24 +112,14 @@ func collectServerStats(serverStats <-chan chasm.Stats) {
 		ingestLatency.Value = int64(stats.IngestLatency)
 		linesAccepted.Value = int64(stats.LinesAccepted)
 
-		// Safe to discard this error because river.WriteLine would only return an error
-		// from writing to the io.Writer; and bytes.Buffer does not fail on writes.
-		_ = river.WriteLine(buf, sk, fields, stats.Time)
-
-		curLines++
-		if curLines >= maxLines {
-			statPayloads <- buf
-			curLines = 0
-			buf = bufPool.Get().(*bytes.Buffer)
-		}
-	}
+		line = river.AppendLine(line[:0], sk, fields, stats.Time)
 
-	// serverStats was closed. May need one last flush.
-	if curLines > 0 {
-		statPayloads <- buf
+		// Only fails after Close, which isn't called until serverStats is closed.
+		_ = bw.WriteLine(line)
 	}
 
-	close(statPayloads)
+	// serverStats was closed. Write the last batch and wait for the writers to finish.
+	bw.Close()
 
 	wg.Done()
 }
@@ -139,6 +132,11 @@ func shutdown(s *chasm.Server) {
 	go func() {
 		s.Close()
 		wg.Wait()
+		if statsFile != nil {
+			if err := statsFile.Close(); err != nil {
+				logger.Printf("Error closing stats file: %s", err.Error())
+			}
+		}
 		done <- struct{}{}
 	}()
 
@@ -151,27 +149,45 @@ func shutdown(s *chasm.Server) {
 	os.Exit(0)
 }
 
-func spawnStatWorkers() {
+// statWriters returns the cfg.Stats.NumWorkers writers that stats are written to.
+func statWriters() []avalanche.LineProtocolWriter {
+	ws := make([]avalanche.LineProtocolWriter, cfg.Stats.NumWorkers)
+
+	if cfg.Stats.File != "" {
+		// All workers share one file, so that every batch is written whole.
+		var err error
+		statsFile, err = avalanche.NewFileWriter(avalanche.FileWriterConfig{
+			Path:     cfg.Stats.File,
+			Gzip:     cfg.Stats.FileGzip,
+			MaxBytes: cfg.Stats.FileMaxBytes,
+		})
+		if err != nil {
+			logger.Fatalf("Error creating stats file: %s", err.Error())
+		}
+
+		for i := range ws {
+			ws[i] = statsFile
+		}
+		return ws
+	}
+
 	c := avalanche.HTTPWriterConfig{
 		Host:     cfg.Stats.Host,
 		Database: cfg.Stats.Database,
+		Org:      cfg.Stats.Org,
+		Bucket:   cfg.Stats.Bucket,
+		Username: cfg.Stats.Username,
+		Password: cfg.Stats.Password,
+		Token:    cfg.Stats.Token,
 	}
-	wg.Add(cfg.Stats.NumWorkers)
-	for i := 0; i < cfg.Stats.NumWorkers; i++ {
-		w := avalanche.NewHTTPWriter(c)
-		go report(w)
+	for i := range ws {
+		ws[i] = avalanche.NewHTTPWriter(c)
 	}
+	return ws
 }
 
-func report(w avalanche.LineProtocolWriter) {
-	for buf := range statPayloads {
-		if _, err := w.WriteLineProtocol(buf.Bytes()); err != nil {
-			logger.Printf("Error writing stats: %s", err.Error())
-		}
-
-		buf.Reset()
-		bufPool.Put(buf)
+func logStatsError(r avalanche.BatchResult) {
+	if r.Err != nil {
+		logger.Printf("Error writing stats: %s", r.Err.Error())
 	}
-
-	wg.Done()
 }
@@ -15,6 +15,7 @@ func main() {
 		"pid": fmt.Sprintf("%d", os.Getpid()),
 	}))
 	seriesKey := flag.String("seriesKey", defaultSeriesKey, "Series key to use in output")
+	noTime := flag.Bool("noTime", false, "Omit timestamps so that the server assigns its own time to each line")
 	flag.Parse()
 
 	sk := []byte(*seriesKey)
@@ -23,6 +24,10 @@ func main() {
 	max := *numLines
 	for i := 0; max == 0 || i < max; i++ {
 		ctrField.Value = int64(i)
-		river.WriteLine(os.Stdout, sk, fields, time.Now().UnixNano())
+		if *noTime {
+			river.WriteLineNoTime(os.Stdout, sk, fields)
+		} else {
+			river.WriteLine(os.Stdout, sk, fields, time.Now().UnixNano())
+		}
 	}
 }
@@ -0,0 +1,57 @@
+package river
+
+import (
+	"bytes"
+	"io"
+	"strings"
+)
+
+// Characters that must be backslash-escaped in each part of a line.
+// See https://docs.influxdata.com/influxdb/latest/write_protocols/line_protocol_reference/#special-characters
+const (
+	measurementEscapes = ", "
+	tagEscapes         = ",= "
+	fieldKeyEscapes    = ",= "
+	stringValueEscapes = `"\`
+)
+
+// appendEscaped appends src to dst, preceding any byte found in chars with a backslash.
+func appendEscaped(dst, src []byte, chars string) []byte {
+	for {
+		i := bytes.IndexAny(src, chars)
+		if i < 0 {
+			return append(dst, src...)
+		}
+
+		dst = append(dst, src[:i]...)
+		dst = append(dst, '\\', src[i])
+		src = src[i+1:]
+	}
+}
+
+// writeEscaped writes b to w, escaping any byte found in chars.
+// When b contains nothing to escape, it is written directly without allocating.
+func writeEscaped(w io.Writer, b []byte, chars string) (int, error) {
+	if bytes.IndexAny(b, chars) < 0 {
+		return w.Write(b)
+	}
+
+	// Guess that there are only a few characters to escape.
+	return w.Write(appendEscaped(make([]byte, 0, len(b)+8), b, chars))
+}
+
+// writeEscapedString writes s to b, escaping any byte found in chars.
+func writeEscapedString(b *bytes.Buffer, s string, chars string) {
+	for {
+		i := strings.IndexAny(s, chars)
+		if i < 0 {
+			b.WriteString(s)
+			return
+		}
+
+		b.WriteString(s[:i])
+		b.WriteByte('\\')
+		b.WriteByte(s[i])
+		s = s[i+1:]
+	}
+}
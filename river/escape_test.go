@@ -0,0 +1,103 @@
+package river_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/mark-rushakoff/mountainflux/river"
+)
+
+var seriesKeyEscapeTests = []struct {
+	measurement string
+	tags        map[string]string
+	exp         string
+}{
+	// Nothing to escape
+	{"cpu", map[string]string{"host": "h1"}, `cpu,host=h1`},
+
+	// Measurement: comma and space, but not equals
+	{"cpu load", nil, `cpu\ load`},
+	{"cpu,load", nil, `cpu\,load`},
+	{"cpu=load", nil, `cpu=load`},
+
+	// Tag keys: comma, equals, and space
+	{"cpu", map[string]string{"host name": "h1"}, `cpu,host\ name=h1`},
+	{"cpu", map[string]string{"host,name": "h1"}, `cpu,host\,name=h1`},
+	{"cpu", map[string]string{"host=name": "h1"}, `cpu,host\=name=h1`},
+
+	// Tag values: comma, equals, and space
+	{"cpu", map[string]string{"host": "h 1"}, `cpu,host=h\ 1`},
+	{"cpu", map[string]string{"host": "h,1"}, `cpu,host=h\,1`},
+	{"cpu", map[string]string{"host": "h=1"}, `cpu,host=h\=1`},
+
+	// Several escapes in a row
+	{"a, b", map[string]string{", =": "= ,"}, `a\,\ b,\,\ \==\=\ \,`},
+}
+
+func TestSeriesKey_Escaping(t *testing.T) {
+	for _, tt := range seriesKeyEscapeTests {
+		got := string(river.SeriesKey(tt.measurement, tt.tags))
+		if got != tt.exp {
+			t.Errorf("SeriesKey(%q, %v): got: %s, exp: %s", tt.measurement, tt.tags, got, tt.exp)
+		}
+	}
+}
+
+var fieldKeyEscapeTests = []struct {
+	field river.Field
+	exp   string
+}{
+	{river.Bool{Name: []byte("lights on"), Value: true}, `lights\ on=T`},
+	{river.Int{Name: []byte("occupants,max"), Value: 3}, `occupants\,max=3i`},
+	{river.Uint{Name: []byte("swipes max"), Value: 3}, `swipes\ max=3u`},
+	{river.Float{Name: []byte("temp=f"), Value: 72.5}, `temp\=f=72.5`},
+	{river.String{Name: []byte("a, =b"), Value: []byte("x")}, `a\,\ \=b="x"`},
+}
+
+func TestField_EscapedName(t *testing.T) {
+	for _, tt := range fieldKeyEscapeTests {
+		var b bytes.Buffer
+		if _, err := tt.field.WriteTo(&b); err != nil {
+			t.Fatalf("exp no error, got: %s", err.Error())
+		}
+
+		if got := b.String(); got != tt.exp {
+			t.Errorf("got: %s, exp: %s", got, tt.exp)
+		}
+	}
+}
+
+func TestField_UnescapedNameDoesNotAllocate(t *testing.T) {
+	var cw CountingWriter
+	f := river.Bool{Name: []byte("lights"), Value: true}
+
+	allocs := testing.AllocsPerRun(100, func() {
+		f.WriteTo(&cw)
+	})
+	if allocs != 0 {
+		t.Fatalf("exp 0 allocations, got: %v", allocs)
+	}
+}
+
+var stringValueEscapeTests = []struct {
+	value string
+	exp   string
+}{
+	{``, `s=""`},
+	{`plain`, `s="plain"`},
+	{`with space, comma=equals`, `s="with space, comma=equals"`},
+	{`say "hi"`, `s="say \"hi\""`},
+	{`C:\dir`, `s="C:\\dir"`},
+	{`\"`, `s="\\\""`},
+}
+
+func TestString_EscapedValue(t *testing.T) {
+	for _, tt := range stringValueEscapeTests {
+		var b bytes.Buffer
+		river.String{Name: []byte("s"), Value: []byte(tt.value)}.WriteTo(&b)
+
+		if got := b.String(); got != tt.exp {
+			t.Errorf("value %q: got: %s, exp: %s", tt.value, got, tt.exp)
+		}
+	}
+}
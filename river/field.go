@@ -6,17 +6,33 @@ import (
 )
 
 // Field represents an InfluxDB field to be serialized by river.WriteLine.
-// The Bool, Int, Float, and String types implement this interface.
+// The Bool, Int, Uint, Float, and String types implement this interface.
 //
-// Implementers of Field should print out the key=value portion of the field.
+// Implementers of Field should print out the key=value portion of the field,
+// escaping the key as the line protocol requires.
 // river.WriteLine will take care of the rest of commas and spaces.
 type Field io.WriterTo
 
+// FieldAppender is implemented by Fields that can append their key=value portion directly to a byte slice.
+// river.AppendLine uses AppendField when available, to avoid allocating.
+// The Bool, Int, Uint, Float, and String types implement this interface.
+type FieldAppender interface {
+	// AppendField appends the key=value portion of the field to dst and returns the extended slice.
+	AppendField(dst []byte) []byte
+}
+
 var (
 	_ Field = Bool{}
 	_ Field = Int{}
+	_ Field = Uint{}
 	_ Field = Float{}
 	_ Field = String{}
+
+	_ FieldAppender = Bool{}
+	_ FieldAppender = Int{}
+	_ FieldAppender = Uint{}
+	_ FieldAppender = Float{}
+	_ FieldAppender = String{}
 )
 
 // Bool represents a boolean InfluxDB field.
@@ -26,13 +42,14 @@ type Bool struct {
 }
 
 var (
-	equalSign = []byte("=")
-	eqTrue    = []byte("=T")
-	eqFalse   = []byte("=F")
+	eqQuote = []byte("=\"")
+	quote   = []byte("\"")
+	eqTrue  = []byte("=T")
+	eqFalse = []byte("=F")
 )
 
 func (b Bool) WriteTo(w io.Writer) (int64, error) {
-	if n, err := w.Write(b.Name); err != nil {
+	if n, err := writeEscaped(w, b.Name, fieldKeyEscapes); err != nil {
 		return int64(n), err
 	}
 
@@ -47,6 +64,14 @@ func (b Bool) WriteTo(w io.Writer) (int64, error) {
 	return int64(n), err
 }
 
+func (b Bool) AppendField(dst []byte) []byte {
+	dst = appendEscaped(dst, b.Name, fieldKeyEscapes)
+	if b.Value {
+		return append(dst, eqTrue...)
+	}
+	return append(dst, eqFalse...)
+}
+
 // Int represents an integer InfluxDB field.
 type Int struct {
 	Name  []byte
@@ -54,7 +79,7 @@ type Int struct {
 }
 
 func (i Int) WriteTo(w io.Writer) (int64, error) {
-	if n, err := w.Write(i.Name); err != nil {
+	if n, err := writeEscaped(w, i.Name, fieldKeyEscapes); err != nil {
 		return int64(n), err
 	}
 
@@ -69,6 +94,43 @@ func (i Int) WriteTo(w io.Writer) (int64, error) {
 	return int64(n), err
 }
 
+func (i Int) AppendField(dst []byte) []byte {
+	dst = appendEscaped(dst, i.Name, fieldKeyEscapes)
+	dst = append(dst, '=')
+	dst = strconv.AppendInt(dst, i.Value, 10)
+	return append(dst, 'i')
+}
+
+// Uint represents an unsigned integer InfluxDB field.
+// Unsigned integers are supported as of InfluxDB 1.4.
+type Uint struct {
+	Name  []byte
+	Value uint64
+}
+
+func (u Uint) WriteTo(w io.Writer) (int64, error) {
+	if n, err := writeEscaped(w, u.Name, fieldKeyEscapes); err != nil {
+		return int64(n), err
+	}
+
+	// Max uint64 fits in 20 base-10 digits;
+	// plus 1 for the leading =, plus 1 for the trailing u required for unsigned ints.
+	uBuf := make([]byte, 1, 22)
+	uBuf[0] = '='
+	uBuf = strconv.AppendUint(uBuf, u.Value, 10)
+	uBuf = append(uBuf, 'u')
+
+	n, err := w.Write(uBuf)
+	return int64(n), err
+}
+
+func (u Uint) AppendField(dst []byte) []byte {
+	dst = appendEscaped(dst, u.Name, fieldKeyEscapes)
+	dst = append(dst, '=')
+	dst = strconv.AppendUint(dst, u.Value, 10)
+	return append(dst, 'u')
+}
+
 // Float represents a floating point InfluxDB field.
 type Float struct {
 	Name  []byte
@@ -76,7 +138,7 @@ type Float struct {
 }
 
 func (f Float) WriteTo(w io.Writer) (int64, error) {
-	if n, err := w.Write(f.Name); err != nil {
+	if n, err := writeEscaped(w, f.Name, fieldKeyEscapes); err != nil {
 		return int64(n), err
 	}
 
@@ -88,19 +150,36 @@ func (f Float) WriteTo(w io.Writer) (int64, error) {
 	return int64(n), err
 }
 
+func (f Float) AppendField(dst []byte) []byte {
+	dst = appendEscaped(dst, f.Name, fieldKeyEscapes)
+	dst = append(dst, '=')
+	return strconv.AppendFloat(dst, f.Value, 'f', -1, 64)
+}
+
 // String represents a string InfluxDB field.
+// The value is written in double quotes, with any embedded double quotes or backslashes escaped.
 type String struct {
 	Name  []byte
 	Value []byte
 }
 
 func (s String) WriteTo(w io.Writer) (int64, error) {
-	if n, err := w.Write(s.Name); err != nil {
+	if n, err := writeEscaped(w, s.Name, fieldKeyEscapes); err != nil {
+		return int64(n), err
+	}
+	if n, err := w.Write(eqQuote); err != nil {
 		return int64(n), err
 	}
-	if n, err := w.Write(equalSign); err != nil {
+	if n, err := writeEscaped(w, s.Value, stringValueEscapes); err != nil {
 		return int64(n), err
 	}
-	n, err := w.Write(s.Value)
+	n, err := w.Write(quote)
 	return int64(n), err
 }
+
+func (s String) AppendField(dst []byte) []byte {
+	dst = appendEscaped(dst, s.Name, fieldKeyEscapes)
+	dst = append(dst, eqQuote...)
+	dst = appendEscaped(dst, s.Value, stringValueEscapes)
+	return append(dst, '"')
+}
@@ -0,0 +1,60 @@
+package river
+
+import (
+	"io"
+	"strconv"
+)
+
+// Point bundles everything needed to write a single line:
+// a measurement, its tags, its fields, and optionally a timestamp.
+//
+// The measurement, tag keys, and tag values are unescaped;
+// they are escaped when the Point is written.
+type Point struct {
+	Measurement []byte
+
+	// Tags are written in the order given.
+	// InfluxDB performs best when tags are sorted by key, as SeriesKeyBuilder.Tags are.
+	Tags []Tag
+
+	Fields []Field
+
+	// Unix time in nanoseconds. Only written if HasTime is true;
+	// otherwise the receiving server assigns its own time.
+	Time    int64
+	HasTime bool
+}
+
+// WritePoint writes p to w, as a single line with a nanosecond timestamp.
+// Returns any error returned during write.
+func WritePoint(w io.Writer, p *Point) error {
+	return WritePointPrecision(w, p, Nanosecond)
+}
+
+// WritePointPrecision is like WritePoint, but p's timestamp is written in precision prec.
+func WritePointPrecision(w io.Writer, p *Point, prec Precision) error {
+	_, err := w.Write(AppendPointPrecision(nil, p, prec))
+	return err
+}
+
+// AppendPoint appends p, as a single line with a nanosecond timestamp, to dst,
+// and returns the extended slice.
+// Like AppendLine, AppendPoint does not allocate when dst has enough capacity
+// and every field implements FieldAppender.
+func AppendPoint(dst []byte, p *Point) []byte {
+	return AppendPointPrecision(dst, p, Nanosecond)
+}
+
+// AppendPointPrecision is like AppendPoint, but p's timestamp is written in precision prec.
+func AppendPointPrecision(dst []byte, p *Point, prec Precision) []byte {
+	dst = appendSeriesKey(dst, p.Measurement, p.Tags)
+	dst = append(dst, ' ')
+	dst = appendFields(dst, p.Fields)
+
+	if p.HasTime {
+		dst = append(dst, ' ')
+		dst = strconv.AppendInt(dst, prec.Convert(p.Time), 10)
+	}
+
+	return append(dst, '\n')
+}
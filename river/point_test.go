@@ -0,0 +1,70 @@
+package river_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/mark-rushakoff/mountainflux/river"
+)
+
+func TestRiver_WritePoint(t *testing.T) {
+	tags := map[string]string{"building": "b 1", "room": "r1"}
+	fields := []river.Field{
+		river.Bool{Name: []byte("lights"), Value: true},
+		river.Int{Name: []byte("occupants"), Value: int64(3)},
+		river.String{Name: []byte("meeting_name"), Value: []byte("bikeshed")},
+	}
+	ts := int64(1435362189575692182)
+
+	skb := river.NewSeriesKeyBuilder("rooms", tags)
+	p := &river.Point{
+		Measurement: []byte("rooms"),
+		Tags:        skb.Tags(),
+		Fields:      fields,
+		Time:        ts,
+		HasTime:     true,
+	}
+
+	for _, prec := range []river.Precision{river.Nanosecond, river.Second} {
+		var exp bytes.Buffer
+		river.WriteLinePrecision(&exp, skb.SeriesKey(), fields, ts, prec)
+
+		var got bytes.Buffer
+		if err := river.WritePointPrecision(&got, p, prec); err != nil {
+			t.Fatalf("exp no error, got: %s", err.Error())
+		}
+		if got.String() != exp.String() {
+			t.Fatalf("precision %s: got: %s, exp: %s", prec, got.String(), exp.String())
+		}
+	}
+
+	// Without a timestamp
+	p.HasTime = false
+	var exp bytes.Buffer
+	river.WriteLineNoTime(&exp, skb.SeriesKey(), fields)
+	if got := river.AppendPoint(nil, p); string(got) != exp.String() {
+		t.Fatalf("got: %s, exp: %s", got, exp.String())
+	}
+}
+
+func TestRiver_AppendPointDoesNotAllocate(t *testing.T) {
+	fields, update := benchmarkFields(true, true, true, true, true)
+	p := &river.Point{
+		Measurement: []byte("rooms"),
+		Tags:        []river.Tag{{Key: []byte("building"), Value: []byte("b1")}},
+		Fields:      fields,
+		HasTime:     true,
+	}
+	buf := make([]byte, 0, 1024)
+
+	var i int
+	allocs := testing.AllocsPerRun(100, func() {
+		update(i)
+		i++
+		p.Time = int64(i)
+		buf = river.AppendPoint(buf[:0], p)
+	})
+	if allocs != 0 {
+		t.Fatalf("exp 0 allocations, got: %v", allocs)
+	}
+}
@@ -0,0 +1,75 @@
+package river
+
+import "fmt"
+
+// Precision is the unit of a timestamp written in line protocol.
+// The zero value is Nanosecond, which is InfluxDB's default.
+type Precision int
+
+const (
+	Nanosecond Precision = iota
+	Microsecond
+	Millisecond
+	Second
+)
+
+// ParsePrecision returns the Precision named by s, which must be one of "ns", "us", "ms", or "s".
+func ParsePrecision(s string) (Precision, error) {
+	switch s {
+	case "ns":
+		return Nanosecond, nil
+	case "us":
+		return Microsecond, nil
+	case "ms":
+		return Millisecond, nil
+	case "s":
+		return Second, nil
+	}
+
+	return Nanosecond, fmt.Errorf("invalid precision %q (must be one of ns, us, ms, s)", s)
+}
+
+// String returns the abbreviated name of p, e.g. "ms".
+func (p Precision) String() string {
+	switch p {
+	case Nanosecond:
+		return "ns"
+	case Microsecond:
+		return "us"
+	case Millisecond:
+		return "ms"
+	case Second:
+		return "s"
+	}
+
+	return fmt.Sprintf("Precision(%d)", int(p))
+}
+
+// Convert converts the nanosecond timestamp ns to p, truncating any finer-grained remainder.
+func (p Precision) Convert(ns int64) int64 {
+	switch p {
+	case Microsecond:
+		return ns / 1e3
+	case Millisecond:
+		return ns / 1e6
+	case Second:
+		return ns / 1e9
+	}
+
+	return ns
+}
+
+// Nanoseconds converts the timestamp t, in precision p, to nanoseconds.
+// It is the inverse of Convert, apart from any remainder Convert truncated.
+func (p Precision) Nanoseconds(t int64) int64 {
+	switch p {
+	case Microsecond:
+		return t * 1e3
+	case Millisecond:
+		return t * 1e6
+	case Second:
+		return t * 1e9
+	}
+
+	return t
+}
@@ -7,13 +7,54 @@ import (
 )
 
 var (
-	space = []byte(" ")
-	comma = []byte(",")
+	space   = []byte(" ")
+	comma   = []byte(",")
+	newline = []byte("\n")
 )
 
 // WriteLine writes the line represented by seriesKey, fields, and time, to w.
+// time is a Unix timestamp in nanoseconds.
 // Returns any error returned during write.
 func WriteLine(w io.Writer, seriesKey []byte, fields []Field, time int64) error {
+	return WriteLinePrecision(w, seriesKey, fields, time, Nanosecond)
+}
+
+// WriteLinePrecision is like WriteLine, but the nanosecond timestamp time is written in precision p.
+// The receiving server must be told to expect precision p, e.g. with avalanche.HTTPWriterConfig.Precision.
+func WriteLinePrecision(w io.Writer, seriesKey []byte, fields []Field, time int64, p Precision) error {
+	if err := writeSeriesKeyAndFields(w, seriesKey, fields); err != nil {
+		return err
+	}
+
+	// Timestamp in nanoseconds, formatted in base 10, should fit in exactly 19 bytes for the foreseeable future;
+	// coarser precisions are shorter.
+	// Plus one byte for the leading space, plus one for the trailing newline.
+	tsBuf := make([]byte, 1, 21)
+	tsBuf[0] = ' '
+	tsBuf = strconv.AppendInt(tsBuf, p.Convert(time), 10)
+	tsBuf = append(tsBuf, '\n')
+
+	if _, err := w.Write(tsBuf); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// WriteLineNoTime writes the line represented by seriesKey and fields to w, without a timestamp.
+// The receiving server will assign its own current time to the line.
+// Returns any error returned during write.
+func WriteLineNoTime(w io.Writer, seriesKey []byte, fields []Field) error {
+	if err := writeSeriesKeyAndFields(w, seriesKey, fields); err != nil {
+		return err
+	}
+
+	_, err := w.Write(newline)
+	return err
+}
+
+// writeSeriesKeyAndFields writes everything in a line up to, but not including, the timestamp.
+func writeSeriesKeyAndFields(w io.Writer, seriesKey []byte, fields []Field) error {
 	// Series key of form `cpu,host=h1,region=west`
 	if _, err := w.Write(seriesKey); err != nil {
 		return err
@@ -36,16 +77,68 @@ func WriteLine(w io.Writer, seriesKey []byte, fields []Field, time int64) error
 		field.WriteTo(w)
 	}
 
-	// Timestamp in nanoseconds, formatted in base 10, should fit in exactly 19 bytes for the foreseeable future.
-	// Plus one byte for the leading space, plus one for the trailing newline.
-	tsBuf := make([]byte, 1, 21)
-	tsBuf[0] = ' '
-	tsBuf = strconv.AppendInt(tsBuf, time, 10)
-	tsBuf = append(tsBuf, '\n')
+	return nil
+}
 
-	if _, err := w.Write(tsBuf); err != nil {
-		return err
+// AppendLine appends the line represented by seriesKey, fields, and time, to dst,
+// and returns the extended slice.
+// The appended bytes are identical to what WriteLine would write.
+//
+// AppendLine does not allocate when dst has enough capacity for the line
+// and every field implements FieldAppender.
+func AppendLine(dst []byte, seriesKey []byte, fields []Field, time int64) []byte {
+	return AppendLinePrecision(dst, seriesKey, fields, time, Nanosecond)
+}
+
+// AppendLinePrecision is like AppendLine, but the nanosecond timestamp time is written in precision p.
+func AppendLinePrecision(dst []byte, seriesKey []byte, fields []Field, time int64, p Precision) []byte {
+	dst = appendSeriesKeyAndFields(dst, seriesKey, fields)
+	dst = append(dst, ' ')
+	dst = strconv.AppendInt(dst, p.Convert(time), 10)
+	return append(dst, '\n')
+}
+
+// AppendLineNoTime appends the line represented by seriesKey and fields to dst, without a timestamp,
+// and returns the extended slice.
+// The appended bytes are identical to what WriteLineNoTime would write.
+func AppendLineNoTime(dst []byte, seriesKey []byte, fields []Field) []byte {
+	dst = appendSeriesKeyAndFields(dst, seriesKey, fields)
+	return append(dst, '\n')
+}
+
+// appendSeriesKeyAndFields appends everything in a line up to, but not including, the timestamp.
+func appendSeriesKeyAndFields(dst []byte, seriesKey []byte, fields []Field) []byte {
+	dst = append(dst, seriesKey...)
+	dst = append(dst, ' ')
+	return appendFields(dst, fields)
+}
+
+// appendFields appends the comma-separated fields to dst.
+func appendFields(dst []byte, fields []Field) []byte {
+	for i, field := range fields {
+		if i != 0 {
+			dst = append(dst, ',')
+		}
+
+		if fa, ok := field.(FieldAppender); ok {
+			dst = fa.AppendField(dst)
+		} else {
+			// Fall back to the field's WriteTo; this path allocates.
+			aw := appendWriter{b: dst}
+			field.WriteTo(&aw)
+			dst = aw.b
+		}
 	}
 
-	return nil
+	return dst
+}
+
+// appendWriter is an io.Writer that appends to a byte slice.
+type appendWriter struct {
+	b []byte
+}
+
+func (w *appendWriter) Write(p []byte) (int, error) {
+	w.b = append(w.b, p...)
+	return len(p), nil
 }
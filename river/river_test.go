@@ -2,6 +2,7 @@ package river_test
 
 import (
 	"bytes"
+	"io"
 	"testing"
 	"time"
 
@@ -16,12 +17,13 @@ func TestRiver_WriteLine(t *testing.T) {
 	river.WriteLine(&b, sk, []river.Field{
 		river.Bool{Name: []byte("lights"), Value: true},
 		river.Int{Name: []byte("occupants"), Value: int64(3)},
+		river.Uint{Name: []byte("badge_swipes"), Value: uint64(18446744073709551615)},
 		river.Float{Name: []byte("temp_f"), Value: 72.5},
 		river.String{Name: []byte("meeting_name"), Value: []byte("bikeshed")},
 	}, int64(1435362189575692182))
 
 	// Tag keys are alphabetized, fields are taken in order, time as entered
-	exp := `rooms,building=b1,room=r1 lights=T,occupants=3i,temp_f=72.5,meeting_name=bikeshed 1435362189575692182` + "\n"
+	exp := `rooms,building=b1,room=r1 lights=T,occupants=3i,badge_swipes=18446744073709551615u,temp_f=72.5,meeting_name="bikeshed" 1435362189575692182` + "\n"
 
 	got := string(b.Bytes())
 	if got != exp {
@@ -29,77 +31,256 @@ func TestRiver_WriteLine(t *testing.T) {
 	}
 }
 
-func benchmarkPointsWithTypes(b *testing.B, useBool, useInt, useFloat, useString bool) {
-	// Build up the series key just once
+var precisionTests = []struct {
+	precision river.Precision
+	exp       string
+}{
+	{river.Nanosecond, "1435362189575692182"},
+	{river.Microsecond, "1435362189575692"},
+	{river.Millisecond, "1435362189575"},
+	{river.Second, "1435362189"},
+}
+
+func TestRiver_WriteLinePrecision(t *testing.T) {
+	sk := []byte("cpu,host=h1")
+	fields := []river.Field{river.Int{Name: []byte("usage"), Value: 99}}
+
+	for _, pt := range precisionTests {
+		exp := "cpu,host=h1 usage=99i " + pt.exp + "\n"
+
+		var b bytes.Buffer
+		river.WriteLinePrecision(&b, sk, fields, 1435362189575692182, pt.precision)
+		if got := b.String(); got != exp {
+			t.Errorf("WriteLinePrecision %s: got: %s, exp: %s", pt.precision, got, exp)
+		}
+
+		got := river.AppendLinePrecision(nil, sk, fields, 1435362189575692182, pt.precision)
+		if string(got) != exp {
+			t.Errorf("AppendLinePrecision %s: got: %s, exp: %s", pt.precision, got, exp)
+		}
+
+		p, err := river.ParsePrecision(pt.precision.String())
+		if err != nil {
+			t.Errorf("exp no error, got: %s", err.Error())
+		} else if p != pt.precision {
+			t.Errorf("ParsePrecision(%q): got: %s, exp: %s", pt.precision.String(), p, pt.precision)
+		}
+	}
+
+	if _, err := river.ParsePrecision("h"); err == nil {
+		t.Errorf("exp error parsing invalid precision, got nil")
+	}
+}
+
+func TestRiver_WriteLineNoTime(t *testing.T) {
+	sk := []byte("cpu,host=h1")
+	fields := []river.Field{
+		river.Int{Name: []byte("usage"), Value: 99},
+		river.Bool{Name: []byte("idle"), Value: false},
+	}
+	exp := "cpu,host=h1 usage=99i,idle=F\n"
+
+	var b bytes.Buffer
+	river.WriteLineNoTime(&b, sk, fields)
+	if got := b.String(); got != exp {
+		t.Fatalf("WriteLineNoTime got: %s, exp: %s", got, exp)
+	}
+
+	if got := river.AppendLineNoTime(nil, sk, fields); string(got) != exp {
+		t.Fatalf("AppendLineNoTime got: %s, exp: %s", got, exp)
+	}
+}
+
+func TestRiver_AppendLine(t *testing.T) {
+	sk := river.SeriesKey("rooms", map[string]string{"room": "r1", "building name": "b1"})
+	fields := []river.Field{
+		river.Bool{Name: []byte("lights"), Value: true},
+		river.Int{Name: []byte("occupants"), Value: int64(-3)},
+		river.Uint{Name: []byte("badge_swipes"), Value: uint64(12)},
+		river.Float{Name: []byte("temp f"), Value: 72.5},
+		river.String{Name: []byte("meeting_name"), Value: []byte(`"bike,shed"`)},
+	}
+	ts := int64(1435362189575692182)
+
+	var b bytes.Buffer
+	river.WriteLine(&b, sk, fields, ts)
+
+	// Append after existing content to ensure dst is extended, not overwritten.
+	prefix := []byte("prefix\n")
+	got := river.AppendLine(prefix, sk, fields, ts)
+	exp := "prefix\n" + b.String()
+	if string(got) != exp {
+		t.Fatalf("got: %s, exp: %s", got, exp)
+	}
+
+	// A Field that only implements io.WriterTo still produces the same output.
+	got = river.AppendLine(nil, sk, []river.Field{writerOnlyField{fields[0]}}, ts)
+	b.Reset()
+	river.WriteLine(&b, sk, fields[:1], ts)
+	if string(got) != b.String() {
+		t.Fatalf("got: %s, exp: %s", got, b.String())
+	}
+}
+
+func TestRiver_AppendLineDoesNotAllocate(t *testing.T) {
 	sk := []byte("rooms,building=b1,room=r1")
+	fields, update := benchmarkFields(true, true, true, true, true)
+	buf := make([]byte, 0, 1024)
+
+	var i int
+	allocs := testing.AllocsPerRun(100, func() {
+		update(i)
+		i++
+		buf = river.AppendLine(buf[:0], sk, fields, int64(i))
+	})
+	if allocs != 0 {
+		t.Fatalf("exp 0 allocations, got: %v", allocs)
+	}
+}
+
+// writerOnlyField hides any methods of the wrapped Field other than WriteTo.
+type writerOnlyField struct {
+	f river.Field
+}
 
+func (f writerOnlyField) WriteTo(w io.Writer) (int64, error) {
+	return f.f.WriteTo(w)
+}
+
+// benchmarkFields returns the fields of the requested types,
+// and a function to update the fields' values in-place for iteration i.
+func benchmarkFields(useBool, useInt, useUint, useFloat, useString bool) ([]river.Field, func(i int)) {
 	// "Random" values to use in the fields
 	lights := []bool{false, true}
 	names := [][]byte{[]byte("bikeshed"), []byte("reactor"), []byte("refreshments"), []byte("ducks")}
 
 	// Allocate fields only once and modify in-place
-	boolField := river.Bool{Name: []byte("lights")}
-	intField := river.Int{Name: []byte("occupants")}
-	floatField := river.Float{Name: []byte("temp_f")}
-	stringField := river.String{Name: []byte("meeting_name")}
+	boolField := &river.Bool{Name: []byte("lights")}
+	intField := &river.Int{Name: []byte("occupants")}
+	uintField := &river.Uint{Name: []byte("badge_swipes")}
+	floatField := &river.Float{Name: []byte("temp_f")}
+	stringField := &river.String{Name: []byte("meeting_name")}
 
 	// Hold collection of fields for later call to WriteLine
-	fields := make([]river.Field, 0, 4)
+	fields := make([]river.Field, 0, 5)
 	if useBool {
-		fields = append(fields, &boolField)
+		fields = append(fields, boolField)
 	}
 	if useInt {
-		fields = append(fields, &intField)
+		fields = append(fields, intField)
+	}
+	if useUint {
+		fields = append(fields, uintField)
 	}
 	if useFloat {
-		fields = append(fields, &floatField)
+		fields = append(fields, floatField)
 	}
 	if useString {
-		fields = append(fields, &stringField)
+		fields = append(fields, stringField)
 	}
 
-	var cw CountingWriter
-	b.ResetTimer()
-	for i := 0; i < b.N; i++ {
+	return fields, func(i int) {
 		if useBool {
 			boolField.Value = lights[i&0x01]
 		}
 		if useInt {
 			intField.Value = int64(i)
 		}
+		if useUint {
+			uintField.Value = uint64(i)
+		}
 		if useFloat {
 			floatField.Value = float64(i) * 2.5
 		}
 		if useString {
 			stringField.Value = names[i&0x03]
 		}
+	}
+}
 
+func benchmarkPointsWithTypes(b *testing.B, useBool, useInt, useUint, useFloat, useString bool) {
+	// Build up the series key just once
+	sk := []byte("rooms,building=b1,room=r1")
+	fields, update := benchmarkFields(useBool, useInt, useUint, useFloat, useString)
+
+	var cw CountingWriter
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		update(i)
 		river.WriteLine(&cw, sk, fields, time.Now().UnixNano())
 	}
 
 	b.SetBytes(cw.N)
 }
 
-///////////////////////////// bool, int, float, string
+func benchmarkAppendWithTypes(b *testing.B, useBool, useInt, useUint, useFloat, useString bool) {
+	// Build up the series key just once
+	sk := []byte("rooms,building=b1,room=r1")
+	fields, update := benchmarkFields(useBool, useInt, useUint, useFloat, useString)
+
+	// Reuse the same buffer for every line, as a caller flushing after each line would.
+	buf := make([]byte, 0, 1024)
+	var n int64
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		update(i)
+		buf = river.AppendLine(buf[:0], sk, fields, time.Now().UnixNano())
+		n += int64(len(buf))
+	}
+
+	b.SetBytes(n)
+}
+
+///////////////////////////// bool, int, uint, float, string
 
 func BenchmarkRiver_WriteLine_EachType(b *testing.B) {
-	benchmarkPointsWithTypes(b, true, true, true, true)
+	benchmarkPointsWithTypes(b, true, true, true, true, true)
 }
 
 func BenchmarkRiver_WriteLine_JustBool(b *testing.B) {
-	benchmarkPointsWithTypes(b, true, false, false, false)
+	benchmarkPointsWithTypes(b, true, false, false, false, false)
 }
 
 func BenchmarkRiver_WriteLine_JustInt(b *testing.B) {
-	benchmarkPointsWithTypes(b, false, true, false, false)
+	benchmarkPointsWithTypes(b, false, true, false, false, false)
+}
+
+func BenchmarkRiver_WriteLine_JustUint(b *testing.B) {
+	benchmarkPointsWithTypes(b, false, false, true, false, false)
 }
 
 func BenchmarkRiver_WriteLine_JustFloat(b *testing.B) {
-	benchmarkPointsWithTypes(b, false, false, true, false)
+	benchmarkPointsWithTypes(b, false, false, false, true, false)
 }
 
 func BenchmarkRiver_WriteLine_JustString(b *testing.B) {
-	benchmarkPointsWithTypes(b, false, false, false, true)
+	benchmarkPointsWithTypes(b, false, false, false, false, true)
+}
+
+func BenchmarkRiver_AppendLine_EachType(b *testing.B) {
+	benchmarkAppendWithTypes(b, true, true, true, true, true)
+}
+
+func BenchmarkRiver_AppendLine_JustBool(b *testing.B) {
+	benchmarkAppendWithTypes(b, true, false, false, false, false)
+}
+
+func BenchmarkRiver_AppendLine_JustInt(b *testing.B) {
+	benchmarkAppendWithTypes(b, false, true, false, false, false)
+}
+
+func BenchmarkRiver_AppendLine_JustUint(b *testing.B) {
+	benchmarkAppendWithTypes(b, false, false, true, false, false)
+}
+
+func BenchmarkRiver_AppendLine_JustFloat(b *testing.B) {
+	benchmarkAppendWithTypes(b, false, false, false, true, false)
+}
+
+func BenchmarkRiver_AppendLine_JustString(b *testing.B) {
+	benchmarkAppendWithTypes(b, false, false, false, false, true)
 }
 
 type CountingWriter struct {
@@ -7,9 +7,12 @@ import (
 
 // SeriesKey is a non-optimized way to create a series key for the line protocol,
 // i.e. a measurement with tag keys and values.
+// The measurement, tag keys, and tag values are escaped as the line protocol requires.
+//
+// To repeatedly build series keys that differ only in their tag values, use a SeriesKeyBuilder.
 func SeriesKey(measurement string, tags map[string]string) []byte {
 	var b bytes.Buffer
-	b.WriteString(measurement)
+	writeEscapedString(&b, measurement, measurementEscapes)
 
 	keys := make([]string, 0, len(tags))
 	for k := range tags {
@@ -20,10 +23,124 @@ func SeriesKey(measurement string, tags map[string]string) []byte {
 	for _, k := range keys {
 		b.WriteByte(',')
 
-		b.WriteString(k)
+		writeEscapedString(&b, k, tagEscapes)
 		b.WriteByte('=')
-		b.WriteString(tags[k])
+		writeEscapedString(&b, tags[k], tagEscapes)
 	}
 
 	return b.Bytes()
 }
+
+// Tag is a single tag key and value, unescaped.
+type Tag struct {
+	Key   []byte
+	Value []byte
+}
+
+// SeriesKeyBuilder renders series keys for one measurement and a set of tags kept sorted by key.
+// Tag values may be changed in place and the series key re-rendered into a reused buffer,
+// so that generators cycling through many tag values don't allocate for every key.
+//
+// The rendered series key is identical to what SeriesKey returns for the same measurement and tags.
+// A SeriesKeyBuilder is not safe for concurrent use.
+type SeriesKeyBuilder struct {
+	measurement []byte
+
+	// Sorted by Key.
+	tags []Tag
+
+	buf []byte
+}
+
+// NewSeriesKeyBuilder returns a SeriesKeyBuilder for measurement, initialized with a copy of tags.
+func NewSeriesKeyBuilder(measurement string, tags map[string]string) *SeriesKeyBuilder {
+	b := &SeriesKeyBuilder{
+		measurement: []byte(measurement),
+		tags:        make([]Tag, 0, len(tags)),
+	}
+
+	for k, v := range tags {
+		b.tags = append(b.tags, Tag{Key: []byte(k), Value: []byte(v)})
+	}
+	sort.Sort(byKey(b.tags))
+
+	return b
+}
+
+// Tags returns the builder's tags, sorted by key.
+// The returned slice must not be modified.
+func (b *SeriesKeyBuilder) Tags() []Tag {
+	return b.tags
+}
+
+// Index returns the index of the tag with the given key in Tags, or -1 if there is no such tag.
+// Callers that update the same tag repeatedly can look up its index once and use SetValueAt.
+func (b *SeriesKeyBuilder) Index(key []byte) int {
+	i := b.search(key)
+	if i < len(b.tags) && bytes.Equal(b.tags[i].Key, key) {
+		return i
+	}
+	return -1
+}
+
+// Set sets the value of the tag with the given key, adding the tag if it doesn't exist.
+// key and value are copied, so the caller is free to reuse them.
+// Setting the value of an existing tag does not allocate once the tag's value has grown to fit.
+func (b *SeriesKeyBuilder) Set(key, value []byte) {
+	i := b.search(key)
+	if i < len(b.tags) && bytes.Equal(b.tags[i].Key, key) {
+		b.SetValueAt(i, value)
+		return
+	}
+
+	b.tags = append(b.tags, Tag{})
+	copy(b.tags[i+1:], b.tags[i:])
+	b.tags[i] = Tag{
+		Key:   append([]byte(nil), key...),
+		Value: append([]byte(nil), value...),
+	}
+}
+
+// SetValueAt sets the value of the tag at index i in Tags.
+// value is copied, so the caller is free to reuse it.
+func (b *SeriesKeyBuilder) SetValueAt(i int, value []byte) {
+	b.tags[i].Value = append(b.tags[i].Value[:0], value...)
+}
+
+// SeriesKey renders the series key into the builder's internal buffer and returns it.
+// The returned slice is only valid until the next call to SeriesKey.
+func (b *SeriesKeyBuilder) SeriesKey() []byte {
+	b.buf = b.AppendSeriesKey(b.buf[:0])
+	return b.buf
+}
+
+// AppendSeriesKey appends the rendered series key to dst and returns the extended slice.
+func (b *SeriesKeyBuilder) AppendSeriesKey(dst []byte) []byte {
+	return appendSeriesKey(dst, b.measurement, b.tags)
+}
+
+// appendSeriesKey appends the escaped measurement and tags, in the given order, to dst.
+func appendSeriesKey(dst []byte, measurement []byte, tags []Tag) []byte {
+	dst = appendEscaped(dst, measurement, measurementEscapes)
+	for _, t := range tags {
+		dst = append(dst, ',')
+		dst = appendEscaped(dst, t.Key, tagEscapes)
+		dst = append(dst, '=')
+		dst = appendEscaped(dst, t.Value, tagEscapes)
+	}
+	return dst
+}
+
+// search returns the index where a tag with the given key is or would be in b.tags.
+func (b *SeriesKeyBuilder) search(key []byte) int {
+	return sort.Search(len(b.tags), func(i int) bool {
+		return bytes.Compare(b.tags[i].Key, key) >= 0
+	})
+}
+
+// byKey sorts tags by key.
+type byKey []Tag
+
+func (t byKey) Len() int           { return len(t) }
+func (t byKey) Less(i, j int) bool { return bytes.Compare(t[i].Key, t[j].Key) < 0 }
+func (t byKey) Swap(i, j int)      { t[i], t[j] = t[j], t[i] }
@@ -0,0 +1,104 @@
+package river_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/mark-rushakoff/mountainflux/river"
+)
+
+func TestSeriesKeyBuilder_MatchesSeriesKey(t *testing.T) {
+	for _, tt := range seriesKeyEscapeTests {
+		b := river.NewSeriesKeyBuilder(tt.measurement, tt.tags)
+		if got := string(b.SeriesKey()); got != tt.exp {
+			t.Errorf("got: %s, exp: %s", got, tt.exp)
+		}
+	}
+}
+
+func TestSeriesKeyBuilder_Set(t *testing.T) {
+	tags := map[string]string{"host": "h1", "region": "west"}
+	b := river.NewSeriesKeyBuilder("cpu", tags)
+
+	// Update an existing tag.
+	b.Set([]byte("host"), []byte("h 2"))
+	tags["host"] = "h 2"
+	if got, exp := string(b.SeriesKey()), string(river.SeriesKey("cpu", tags)); got != exp {
+		t.Fatalf("got: %s, exp: %s", got, exp)
+	}
+
+	// Add new tags before, between, and after the existing ones.
+	for _, k := range []string{"az", "dc", "zone"} {
+		b.Set([]byte(k), []byte(k+"-value"))
+		tags[k] = k + "-value"
+	}
+	if got, exp := string(b.SeriesKey()), string(river.SeriesKey("cpu", tags)); got != exp {
+		t.Fatalf("got: %s, exp: %s", got, exp)
+	}
+
+	// Update by index.
+	i := b.Index([]byte("region"))
+	if i < 0 {
+		t.Fatalf("exp to find region tag")
+	}
+	b.SetValueAt(i, []byte("east"))
+	tags["region"] = "east"
+	if got, exp := string(b.SeriesKey()), string(river.SeriesKey("cpu", tags)); got != exp {
+		t.Fatalf("got: %s, exp: %s", got, exp)
+	}
+
+	if i := b.Index([]byte("missing")); i != -1 {
+		t.Fatalf("exp index -1 for missing tag, got: %d", i)
+	}
+}
+
+func TestSeriesKeyBuilder_SetDoesNotAllocate(t *testing.T) {
+	b := river.NewSeriesKeyBuilder("cpu", map[string]string{"host": "host-0000", "region": "west"})
+	hosts := make([][]byte, 16)
+	for i := range hosts {
+		hosts[i] = []byte(fmt.Sprintf("host-%04d", i))
+	}
+	key := []byte("host")
+	b.SeriesKey()
+
+	var i int
+	allocs := testing.AllocsPerRun(100, func() {
+		b.Set(key, hosts[i&0x0f])
+		i++
+		b.SeriesKey()
+	})
+	if allocs != 0 {
+		t.Fatalf("exp 0 allocations, got: %v", allocs)
+	}
+}
+
+func BenchmarkSeriesKey(b *testing.B) {
+	tags := map[string]string{"host": "", "region": "west", "service": "api"}
+	hosts := make([]string, 1000)
+	for i := range hosts {
+		hosts[i] = fmt.Sprintf("host-%04d", i)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		tags["host"] = hosts[i%len(hosts)]
+		river.SeriesKey("cpu", tags)
+	}
+}
+
+func BenchmarkSeriesKeyBuilder(b *testing.B) {
+	sb := river.NewSeriesKeyBuilder("cpu", map[string]string{"host": "", "region": "west", "service": "api"})
+	hostIdx := sb.Index([]byte("host"))
+	hosts := make([][]byte, 1000)
+	for i := range hosts {
+		hosts[i] = []byte(fmt.Sprintf("host-%04d", i))
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		sb.SetValueAt(hostIdx, hosts[i%len(hosts)])
+		sb.SeriesKey()
+	}
+}
@@ -0,0 +1,168 @@
+package river
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+)
+
+var (
+	// ErrEmptyMeasurement is returned when validating a line whose measurement is empty.
+	ErrEmptyMeasurement = errors.New("river: empty measurement")
+
+	// ErrNoFields is returned when validating a line that has no fields.
+	ErrNoFields = errors.New("river: no fields")
+)
+
+// DuplicateFieldError is returned when validating a line that has more than one field with the same name.
+type DuplicateFieldError struct {
+	Name []byte
+}
+
+func (e *DuplicateFieldError) Error() string {
+	return fmt.Sprintf("river: duplicate field %q", e.Name)
+}
+
+// InvalidFloatError is returned when validating a line with a NaN or infinite float field,
+// neither of which line protocol can represent.
+type InvalidFloatError struct {
+	Name  []byte
+	Value float64
+}
+
+func (e *InvalidFloatError) Error() string {
+	return fmt.Sprintf("river: invalid value %v for float field %q", e.Value, e.Name)
+}
+
+// ReservedFieldNameError is returned when validating a line with a field name starting with an underscore,
+// which InfluxDB reserves for its own use.
+type ReservedFieldNameError struct {
+	Name []byte
+}
+
+func (e *ReservedFieldNameError) Error() string {
+	return fmt.Sprintf("river: reserved field name %q", e.Name)
+}
+
+// ValidateLine checks that the line represented by seriesKey and fields would be accepted by InfluxDB.
+// It returns ErrEmptyMeasurement, ErrNoFields, or a *DuplicateFieldError, *InvalidFloatError,
+// or *ReservedFieldNameError describing the first problem found.
+//
+// Only the Bool, Int, Uint, Float, and String field types, and pointers to them, have their names and values checked.
+func ValidateLine(seriesKey []byte, fields []Field) error {
+	if len(seriesKey) == 0 || seriesKey[0] == ',' || seriesKey[0] == ' ' {
+		return ErrEmptyMeasurement
+	}
+	return validateFields(fields)
+}
+
+// ValidatePoint is like ValidateLine, for a Point.
+func ValidatePoint(p *Point) error {
+	if len(p.Measurement) == 0 {
+		return ErrEmptyMeasurement
+	}
+	return validateFields(p.Fields)
+}
+
+func validateFields(fields []Field) error {
+	if len(fields) == 0 {
+		return ErrNoFields
+	}
+
+	for i, f := range fields {
+		name, ok := fieldName(f)
+		if !ok {
+			continue
+		}
+
+		if len(name) > 0 && name[0] == '_' {
+			return &ReservedFieldNameError{Name: name}
+		}
+
+		// Lines rarely have many fields, so a quadratic search is cheaper than allocating a set.
+		for _, prev := range fields[:i] {
+			if prevName, ok := fieldName(prev); ok && bytes.Equal(name, prevName) {
+				return &DuplicateFieldError{Name: name}
+			}
+		}
+
+		var v float64
+		switch f := f.(type) {
+		case Float:
+			v = f.Value
+		case *Float:
+			v = f.Value
+		default:
+			continue
+		}
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return &InvalidFloatError{Name: name, Value: v}
+		}
+	}
+
+	return nil
+}
+
+// fieldName returns the name of f, if f is one of river's own field types.
+func fieldName(f Field) ([]byte, bool) {
+	switch f := f.(type) {
+	case Bool:
+		return f.Name, true
+	case *Bool:
+		return f.Name, true
+	case Int:
+		return f.Name, true
+	case *Int:
+		return f.Name, true
+	case Uint:
+		return f.Name, true
+	case *Uint:
+		return f.Name, true
+	case Float:
+		return f.Name, true
+	case *Float:
+		return f.Name, true
+	case String:
+		return f.Name, true
+	case *String:
+		return f.Name, true
+	}
+
+	return nil, false
+}
+
+// ValidatingWriter validates each line before writing it to W,
+// so that generators fail fast locally instead of having the target server reject a whole batch.
+// Invalid lines are not written.
+type ValidatingWriter struct {
+	W io.Writer
+
+	// Precision of the timestamps written.
+	Precision Precision
+}
+
+// WriteLine validates the line with ValidateLine, then writes it as WriteLinePrecision would.
+func (v *ValidatingWriter) WriteLine(seriesKey []byte, fields []Field, time int64) error {
+	if err := ValidateLine(seriesKey, fields); err != nil {
+		return err
+	}
+	return WriteLinePrecision(v.W, seriesKey, fields, time, v.Precision)
+}
+
+// WriteLineNoTime validates the line with ValidateLine, then writes it as WriteLineNoTime would.
+func (v *ValidatingWriter) WriteLineNoTime(seriesKey []byte, fields []Field) error {
+	if err := ValidateLine(seriesKey, fields); err != nil {
+		return err
+	}
+	return WriteLineNoTime(v.W, seriesKey, fields)
+}
+
+// WritePoint validates p with ValidatePoint, then writes it as WritePointPrecision would.
+func (v *ValidatingWriter) WritePoint(p *Point) error {
+	if err := ValidatePoint(p); err != nil {
+		return err
+	}
+	return WritePointPrecision(v.W, p, v.Precision)
+}
@@ -0,0 +1,79 @@
+package river_test
+
+import (
+	"bytes"
+	"math"
+	"reflect"
+	"testing"
+
+	"github.com/mark-rushakoff/mountainflux/river"
+)
+
+var validateTests = []struct {
+	seriesKey string
+	fields    []river.Field
+	exp       error
+}{
+	{"cpu,host=h1", []river.Field{river.Int{Name: []byte("usage"), Value: 1}}, nil},
+	{"", []river.Field{river.Int{Name: []byte("usage"), Value: 1}}, river.ErrEmptyMeasurement},
+	{",host=h1", []river.Field{river.Int{Name: []byte("usage"), Value: 1}}, river.ErrEmptyMeasurement},
+	{"cpu", nil, river.ErrNoFields},
+	{
+		"cpu",
+		[]river.Field{river.Int{Name: []byte("usage"), Value: 1}, &river.Float{Name: []byte("usage"), Value: 1}},
+		&river.DuplicateFieldError{Name: []byte("usage")},
+	},
+	{
+		"cpu",
+		[]river.Field{&river.Float{Name: []byte("usage"), Value: math.Inf(-1)}},
+		&river.InvalidFloatError{Name: []byte("usage"), Value: math.Inf(-1)},
+	},
+	{
+		"cpu",
+		[]river.Field{river.Bool{Name: []byte("_measurement"), Value: true}},
+		&river.ReservedFieldNameError{Name: []byte("_measurement")},
+	},
+}
+
+func TestValidateLine(t *testing.T) {
+	for i, vt := range validateTests {
+		err := river.ValidateLine([]byte(vt.seriesKey), vt.fields)
+		if !reflect.DeepEqual(err, vt.exp) {
+			t.Errorf("test %d: exp error: %v, got: %v", i, vt.exp, err)
+		}
+	}
+
+	// NaN is checked separately, since NaN != NaN.
+	err := river.ValidateLine([]byte("cpu"), []river.Field{river.Float{Name: []byte("usage"), Value: math.NaN()}})
+	if e, ok := err.(*river.InvalidFloatError); !ok || !math.IsNaN(e.Value) {
+		t.Errorf("exp *InvalidFloatError with NaN value, got: %v", err)
+	}
+}
+
+func TestValidatingWriter(t *testing.T) {
+	var b bytes.Buffer
+	vw := &river.ValidatingWriter{W: &b, Precision: river.Second}
+
+	if err := vw.WriteLine([]byte("cpu"), nil, 1e9); err != river.ErrNoFields {
+		t.Fatalf("exp ErrNoFields, got: %v", err)
+	}
+	if err := vw.WritePoint(&river.Point{Fields: []river.Field{river.Int{Name: []byte("f")}}}); err != river.ErrEmptyMeasurement {
+		t.Fatalf("exp ErrEmptyMeasurement, got: %v", err)
+	}
+	if b.Len() != 0 {
+		t.Fatalf("exp invalid lines not to be written, got: %s", b.String())
+	}
+
+	fields := []river.Field{river.Int{Name: []byte("f"), Value: 1}}
+	if err := vw.WriteLine([]byte("cpu"), fields, 2e9); err != nil {
+		t.Fatalf("exp no error, got: %s", err.Error())
+	}
+	if err := vw.WriteLineNoTime([]byte("cpu"), fields); err != nil {
+		t.Fatalf("exp no error, got: %s", err.Error())
+	}
+
+	exp := "cpu f=1i 2\ncpu f=1i\n"
+	if got := b.String(); got != exp {
+		t.Fatalf("got: %s, exp: %s", got, exp)
+	}
+}